@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin/cleaner"
+)
+
+// runBatch cleans a zip or directory of workbooks from the command line and
+// writes the CSVs and manifest under outDir.
+func runBatch(batchPath string, outDir string, profile cleaner.Profile) error {
+	info, err := os.Stat(batchPath)
+	if err != nil {
+		return err
+	}
+
+	var results []cleaner.BatchResult
+	if info.IsDir() {
+		results, err = cleaner.CleanDir(batchPath, profile)
+	} else {
+		file, openErr := os.Open(batchPath)
+		if openErr != nil {
+			return openErr
+		}
+		defer file.Close()
+		results, err = cleaner.CleanZip(file, info.Size(), profile)
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("Skipping %s: %v\n", result.Name, result.Err)
+			failed++
+			continue
+		}
+
+		folder := filepath.Join(outDir, filepath.FromSlash(cleaner.BatchFolder(result.Name)))
+		if rel, err := filepath.Rel(outDir, folder); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s would be written outside %s", result.Name, outDir)
+		}
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(folder, "credits.csv"), []byte(result.CreditCSV), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(folder, "debits.csv"), []byte(result.DebitCSV), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	manifest, err := os.Create(filepath.Join(outDir, "manifest.csv"))
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	if err := cleaner.WriteManifest(manifest, results); err != nil {
+		return err
+	}
+
+	fmt.Printf("Cleaned %d of %d workbooks into %s\n", len(results)-failed, len(results), outDir)
+	return nil
+}
+
+// batchHandler cleans a zip of workbooks uploaded as "file" and responds with
+// a zip of per-workbook CSVs and the manifest.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Unable to read file from form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	profile := cleaner.DefaultProfile
+	if password := r.FormValue("password"); password != "" {
+		profile.Password = password
+	}
+
+	results, err := cleaner.CleanZip(file, header.Size, profile)
+	if err != nil {
+		http.Error(w, "Error reading zip file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cleaner.WriteBatchZip(buf, results); err != nil {
+		http.Error(w, "Error creating zip file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=batch_files.zip")
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		http.Error(w, "Error writing response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
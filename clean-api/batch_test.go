@@ -0,0 +1,50 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin/cleaner"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestRunBatchStaysInOutDir(t *testing.T) {
+	dir := t.TempDir()
+	f := excelize.NewFile()
+	workbook, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	batchPath := filepath.Join(dir, "batch.zip")
+	file, err := os.Create(batchPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(file)
+	for _, name := range []string{"../escape.xlsx", "inside.xlsx"} {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(workbook.Bytes())
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	outDir := filepath.Join(dir, "out")
+	if err := runBatch(batchPath, outDir, cleaner.DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape")); !os.IsNotExist(err) {
+		t.Errorf("../escape.xlsx was written outside the output directory")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "inside", "credits.csv")); err != nil {
+		t.Errorf("inside.xlsx: %v", err)
+	}
+}
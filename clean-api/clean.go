@@ -3,138 +3,89 @@ package main
 import (
 	"archive/zip"
 	"bytes"
-	"encoding/csv"
-	"fmt"
+	"errors"
+	"flag"
 	"io"
+	"log"
 	"net/http"
-	"os"
 	"strconv"
-	"strings"
 
+	"github.com/gin-gonic/gin/cleaner"
+	"github.com/gin-gonic/gin/ingest"
 	"github.com/gorilla/handlers"
 	"github.com/xuri/excelize/v2"
 )
 
-// CleanSpreadsheet function to process the uploaded file
-func CleanSpreadsheet(filePath string) (string, string, error) {
-	f, err := excelize.OpenFile(filePath)
-	if err != nil {
-		return "", "", err
-	}
-	defer f.Close()
-
-	var creditCSV, debitCSV string
-
-	for _, sheet := range f.GetSheetList() {
-		// Remove merged cells
-		mergedCells, err := f.GetMergeCells(sheet)
-		if err != nil {
-			return "", "", err
-		}
-		for _, mc := range mergedCells {
-			err = f.UnmergeCell(sheet, mc.GetStartAxis(), mc.GetEndAxis())
-			if err != nil {
-				return "", "", err
-			}
-		}
-
-		// Remove the first 25 rows
-		for i := 1; i <= 25; i++ {
-			err := f.RemoveRow(sheet, i)
-			if err != nil {
-				return "", "", err
-			}
-		}
-
-		// Remove the last 14 merged rows
-		lastRow, err := f.GetRows(sheet)
-		if err != nil {
-			return "", "", err
-		}
-		for i := len(lastRow) - 14; i < len(lastRow); i++ {
-			err := f.RemoveRow(sheet, i+1) // i+1 because row indices are 1-based
-			if err != nil {
-				return "", "", err
-			}
-		}
-
-		var csvData strings.Builder
-		writer := csv.NewWriter(&csvData)
-		defer writer.Flush()
-
-		// Extract only values from columns A, Y, and AL and write them to CSV
-		rows, err := f.GetRows(sheet)
-		if err != nil {
-			return "", "", err
-		}
-
-		for _, row := range rows {
-			if len(row) >= 39 { // Check if the row has at least 39 columns
-				amountStr := row[37]
-				amountStr = strings.Replace(amountStr, ",", "", -1)
-
-				if strings.HasPrefix(amountStr, "-") {
-					amountStr = amountStr[1:]
-				}
-
-				amount, err := strconv.ParseFloat(amountStr, 64)
-				if err != nil {
-					fmt.Println("Error parsing amount:", err)
-					continue
-				}
-
-				formattedAmount := strconv.FormatFloat(amount, 'f', -1, 64)
-				newRow := []string{row[0], row[24], formattedAmount}
-				err = writer.Write(newRow)
-				if err != nil {
-					return "", "", err
-				}
-			}
-		}
-
-		writer.Flush()
-
-		if sheet == "Sheet1" {
-			creditCSV = csvData.String()
-		} else if sheet == "Sheet2" {
-			debitCSV = csvData.String()
-		}
-	}
-
-	return creditCSV, debitCSV, nil
-}
-
+// Handler that reads an uploaded file in any format of the ingest package
+// and responds with a zip of the credit and debit CSVs and rejected.csv, the
+// rows that couldn't be read, also counted in the X-Rejected-Rows header.
+// Workbooks take an optional "password" and journals the "account" whose
+// postings to read. CSV rows, which have no side, go to "side", credit by
+// default; their dialect can be set with the csv_delimiter, csv_quote,
+// csv_encoding, csv_decimal and csv_thousands fields.
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	file, _, err := r.FormFile("file")
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "Unable to read file from form", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	tmpFile, err := os.CreateTemp("", "uploaded-*.xlsx")
+	data, err := io.ReadAll(file)
 	if err != nil {
-		http.Error(w, "Unable to create temporary file", http.StatusInternalServerError)
+		http.Error(w, "Unable to read uploaded file", http.StatusBadRequest)
 		return
 	}
-	defer os.Remove(tmpFile.Name())
 
-	if _, err := io.Copy(tmpFile, file); err != nil {
-		http.Error(w, "Unable to save uploaded file", http.StatusInternalServerError)
+	dialect := ingest.FormDialect(r.FormValue)
+	if err := dialect.Validate(); err != nil {
+		http.Error(w, "Invalid CSV dialect: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	creditCSV, debitCSV, err := CleanSpreadsheet(tmpFile.Name())
+	document, err := ingest.Parse(header.Filename, data, ingest.Options{
+		Account:  r.FormValue("account"),
+		Password: r.FormValue("password"),
+		CSV:      dialect,
+	})
+	if errors.Is(err, excelize.ErrWorkbookPassword) || errors.Is(err, zip.ErrFormat) || errors.Is(err, ingest.ErrUnknownFormat) {
+		http.Error(w, "Error processing file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error processing file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	side := r.FormValue("side")
+	if side == "" {
+		side = ingest.Credit
+	}
+	if side != ingest.Credit && side != ingest.Debit {
+		http.Error(w, "Invalid side, expected credit or debit", http.StatusBadRequest)
+		return
+	}
+	credits, debits := document.Split(side)
+
+	var creditCSV, debitCSV, rejectedCSV bytes.Buffer
+	if err := ingest.WriteCSV(&creditCSV, credits); err != nil {
+		http.Error(w, "Error processing file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ingest.WriteCSV(&debitCSV, debits); err != nil {
+		http.Error(w, "Error processing file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ingest.WriteRejectedCSV(&rejectedCSV, document.Rejected); err != nil {
+		http.Error(w, "Error processing file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Create a zip archive in memory
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
@@ -145,7 +96,7 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error creating zip file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	creditFile.Write([]byte(creditCSV))
+	creditFile.Write(creditCSV.Bytes())
 
 	// Add debits.csv to the zip archive
 	debitFile, err := zipWriter.Create("debits.csv")
@@ -153,7 +104,15 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error creating zip file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	debitFile.Write([]byte(debitCSV))
+	debitFile.Write(debitCSV.Bytes())
+
+	// Add rejected.csv to the zip archive
+	rejectedFile, err := zipWriter.Create("rejected.csv")
+	if err != nil {
+		http.Error(w, "Error creating zip file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rejectedFile.Write(rejectedCSV.Bytes())
 
 	// Close the zip archive
 	if err := zipWriter.Close(); err != nil {
@@ -164,6 +123,7 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	// Set response headers
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", "attachment; filename=processed_files.zip")
+	w.Header().Set("X-Rejected-Rows", strconv.Itoa(len(document.Rejected)))
 
 	// Write the zip archive to the response
 	if _, err := w.Write(buf.Bytes()); err != nil {
@@ -173,11 +133,28 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	// Define command-line flags
+	batchPath := flag.String("batch", "", "Zip file or directory of workbooks to clean")
+	outDir := flag.String("o", "cleaned", "Output directory for batch mode")
+	password := flag.String("password", "", "Password of protected workbooks")
+
+	flag.Parse()
+
+	if *batchPath != "" {
+		profile := cleaner.DefaultProfile
+		profile.Password = *password
+		if err := runBatch(*batchPath, *outDir, profile); err != nil {
+			log.Fatalf("Error cleaning batch: %v", err)
+		}
+		return
+	}
+
 	// Create a new router
 	router := http.NewServeMux()
 
-	// Handle the upload route
+	// Handle the upload routes
 	router.HandleFunc("/upload", uploadHandler)
+	router.HandleFunc("/batch", batchHandler)
 
 	// Add CORS middleware
 	corsHandler := handlers.CORS(
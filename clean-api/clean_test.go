@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadHandlerReturnsRejectedRows(t *testing.T) {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("file", "credits.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(part, "INV1,1/5/2024,100\nINV2,someday,50\nINV3,1/6/2024,75.5\n")
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	uploadHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Rejected-Rows"); got != "1" {
+		t.Errorf("X-Rejected-Rows %q, want 1", got)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, zf := range zipReader.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[zf.Name] = string(data)
+	}
+
+	if lines := strings.Count(files["credits.csv"], "\n"); lines != 2 {
+		t.Errorf("credits.csv has %d rows, want 2:\n%s", lines, files["credits.csv"])
+	}
+	rejected := strings.Split(strings.TrimSpace(files["rejected.csv"]), "\n")
+	if len(rejected) != 2 || rejected[0] != "Line,Reason,Record" || !strings.HasPrefix(rejected[1], "2,") || !strings.HasSuffix(rejected[1], ",INV2,someday,50") {
+		t.Errorf("rejected.csv:\n%s", files["rejected.csv"])
+	}
+}
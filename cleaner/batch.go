@@ -0,0 +1,223 @@
+package cleaner
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxBatchEntrySize caps the decompressed size of a workbook in a zip.
+var maxBatchEntrySize int64 = 100 << 20
+
+// BatchResult is the outcome of cleaning one workbook of a batch.
+type BatchResult struct {
+	Name      string
+	CreditCSV string
+	DebitCSV  string
+	Err       error
+}
+
+// isWorkbook reports whether a file in a batch should be cleaned. Excel
+// lock files and the metadata folders macOS adds to zips are ignored.
+func isWorkbook(name string) bool {
+	base := path.Base(filepath.ToSlash(name))
+	if strings.HasPrefix(base, "~$") || strings.HasPrefix(base, "._") || strings.HasPrefix(filepath.ToSlash(name), "__MACOSX/") {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(base))
+	return ext == ".xlsx" || ext == ".xlsm"
+}
+
+// CleanZip cleans every workbook in a zip archive. A workbook that
+// can't be cleaned doesn't stop the batch, its error goes in the manifest.
+func CleanZip(r io.ReaderAt, size int64, profile Profile) ([]BatchResult, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BatchResult
+	for _, zf := range zipReader.File {
+		if zf.FileInfo().IsDir() || !isWorkbook(zf.Name) {
+			continue
+		}
+
+		result := BatchResult{Name: zf.Name}
+		data, err := readBatchEntry(zf)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+
+		opts := openOptions(profile, nil)
+		f, err := excelize.OpenReader(bytes.NewReader(data), opts...)
+		if err != nil {
+			result.Err = openError(err, opts)
+		} else {
+			result.CreditCSV, result.DebitCSV, result.Err = CleanWorkbook(f, profile)
+			f.Close()
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	return results, nil
+}
+
+// readBatchEntry reads a workbook out of a zip. Names that would place its
+// CSVs outside the batch folder, absolute ones or ones with "..", are
+// refused, and so are workbooks larger than maxBatchEntrySize.
+func readBatchEntry(zf *zip.File) ([]byte, error) {
+	name := strings.ReplaceAll(zf.Name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return nil, fmt.Errorf("unsafe path %q: absolute", zf.Name)
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return nil, fmt.Errorf("unsafe path %q: contains ..", zf.Name)
+		}
+	}
+	if zf.UncompressedSize64 > uint64(maxBatchEntrySize) {
+		return nil, fmt.Errorf("workbook larger than %d bytes", maxBatchEntrySize)
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// The size in the header may lie
+	data, err := io.ReadAll(io.LimitReader(rc, maxBatchEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBatchEntrySize {
+		return nil, fmt.Errorf("workbook larger than %d bytes", maxBatchEntrySize)
+	}
+	return data, nil
+}
+
+// CleanDir cleans every workbook directly inside a directory.
+func CleanDir(dir string, profile Profile) ([]BatchResult, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BatchResult
+	for _, entry := range entries {
+		if entry.IsDir() || !isWorkbook(entry.Name()) {
+			continue
+		}
+
+		result := BatchResult{Name: entry.Name()}
+		result.CreditCSV, result.DebitCSV, result.Err = CleanSpreadsheet(filepath.Join(dir, entry.Name()), profile)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// BatchFolder is the folder a workbook's CSVs are written to, its path in
+// the batch without the extension.
+func BatchFolder(name string) string {
+	name = filepath.ToSlash(name)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// WriteManifest writes one line per workbook with the row counts and totals
+// of both sides, or the reason it couldn't be cleaned.
+func WriteManifest(w io.Writer, results []BatchResult) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"Workbook", "Folder", "Credit Rows", "Credit Total", "Debit Rows", "Debit Total", "Error"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		record := []string{result.Name, BatchFolder(result.Name), "", "", "", "", ""}
+		if result.Err != nil {
+			record[6] = result.Err.Error()
+		} else {
+			creditRows, creditTotal := summarizeCSV(result.CreditCSV)
+			debitRows, debitTotal := summarizeCSV(result.DebitCSV)
+			record[2] = strconv.Itoa(creditRows)
+			record[3] = fmt.Sprintf("%.2f", creditTotal)
+			record[4] = strconv.Itoa(debitRows)
+			record[5] = fmt.Sprintf("%.2f", debitTotal)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// summarizeCSV counts the rows of a cleaned CSV and adds up their amounts.
+func summarizeCSV(data string) (int, float64) {
+	records, _ := csv.NewReader(strings.NewReader(data)).ReadAll()
+	total := 0.0
+	for _, record := range records {
+		if amount, err := strconv.ParseFloat(record[2], 64); err == nil {
+			total += amount
+		}
+	}
+	return len(records), total
+}
+
+// WriteBatchZip packs the CSVs of every cleaned workbook into a zip, one
+// folder per workbook, with the manifest at the top.
+func WriteBatchZip(w io.Writer, results []BatchResult) error {
+	zipWriter := zip.NewWriter(w)
+
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		folder := BatchFolder(result.Name)
+
+		creditFile, err := zipWriter.Create(folder + "/credits.csv")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(creditFile, result.CreditCSV); err != nil {
+			return err
+		}
+
+		debitFile, err := zipWriter.Create(folder + "/debits.csv")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(debitFile, result.DebitCSV); err != nil {
+			return err
+		}
+	}
+
+	manifestFile, err := zipWriter.Create("manifest.csv")
+	if err != nil {
+		return err
+	}
+	if err := WriteManifest(manifestFile, results); err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
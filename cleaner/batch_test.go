@@ -0,0 +1,83 @@
+package cleaner
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestCleanZipRefusesUnsafeEntries(t *testing.T) {
+	f := excelize.NewFile()
+	workbook, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+	for _, name := range []string{"ok.xlsx", "sub/ok.xlsx", "../../x.xlsx", "a/../../b.xlsx", "/abs.xlsx", `..\win.xlsx`, `C:\abs.xlsx`, "big.xlsx"} {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := workbook.Bytes()
+		if name == "big.xlsx" {
+			data = bytes.Repeat([]byte{0}, workbook.Len()+1)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(size int64) { maxBatchEntrySize = size }(maxBatchEntrySize)
+	maxBatchEntrySize = int64(workbook.Len())
+
+	results, err := CleanZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"ok.xlsx":        "",
+		"sub/ok.xlsx":    "",
+		"../../x.xlsx":   "unsafe path",
+		"a/../../b.xlsx": "unsafe path",
+		"/abs.xlsx":      "unsafe path",
+		`..\win.xlsx`:    "unsafe path",
+		`C:\abs.xlsx`:    "unsafe path",
+		"big.xlsx":       "larger than",
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		wantErr := want[result.Name]
+		switch {
+		case wantErr == "" && result.Err != nil:
+			t.Errorf("%s: %v", result.Name, result.Err)
+		case wantErr != "" && (result.Err == nil || !strings.Contains(result.Err.Error(), wantErr)):
+			t.Errorf("%s: error %v, want %q", result.Name, result.Err, wantErr)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if err := WriteBatchZip(out, results); err != nil {
+		t.Fatal(err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, zf := range zipReader.File {
+		if strings.Contains(zf.Name, "..") || strings.HasPrefix(zf.Name, "/") {
+			t.Errorf("batch zip holds %s", zf.Name)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package cleaner turns ERP spreadsheet exports into the credit and debit
+// CSVs read by the reconciler. Each CSV row holds the reference, the date as
+// 1/2/2006, the unsigned amount and the sheet row it came from.
+package cleaner
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// CleanSpreadsheet function to process the uploaded file. The open options
+// are passed on to excelize; the profile's password is used when none of
+// them carries one.
+func CleanSpreadsheet(filePath string, profile Profile, opts ...excelize.Options) (string, string, error) {
+	opts = openOptions(profile, opts)
+	f, err := excelize.OpenFile(filePath, opts...)
+	if err != nil {
+		return "", "", openError(err, opts)
+	}
+	defer f.Close()
+
+	return CleanWorkbook(f, profile)
+}
+
+// CleanReader cleans a workbook read from r, without going through a file
+// on disk.
+func CleanReader(r io.Reader, profile Profile, opts ...excelize.Options) (string, string, error) {
+	opts = openOptions(profile, opts)
+	f, err := excelize.OpenReader(r, opts...)
+	if err != nil {
+		return "", "", openError(err, opts)
+	}
+	defer f.Close()
+
+	return CleanWorkbook(f, profile)
+}
+
+// openOptions adds the profile's password to the excelize open options
+// unless the caller supplied one.
+func openOptions(profile Profile, opts []excelize.Options) []excelize.Options {
+	if profile.Password == "" {
+		return opts
+	}
+	for _, opt := range opts {
+		if opt.Password != "" {
+			return opts
+		}
+	}
+	return append(opts, excelize.Options{Password: profile.Password})
+}
+
+// openError explains the zip error excelize returns when an encrypted
+// workbook is opened without a password.
+func openError(err error, opts []excelize.Options) error {
+	if !errors.Is(err, zip.ErrFormat) {
+		return err
+	}
+	for _, opt := range opts {
+		if opt.Password != "" {
+			return err
+		}
+	}
+	return fmt.Errorf("%w (password protected workbooks need a password)", err)
+}
+
+// CleanWorkbook cleans the credit and debit sheets of an open workbook.
+func CleanWorkbook(f *excelize.File, profile Profile) (string, string, error) {
+	if err := profile.Validate(); err != nil {
+		return "", "", err
+	}
+	var creditCSV, debitCSV strings.Builder
+	if err := cleanSheet(f, profile.CreditSheet, profile, &creditCSV); err != nil {
+		return "", "", err
+	}
+	if err := cleanSheet(f, profile.DebitSheet, profile, &debitCSV); err != nil {
+		return "", "", err
+	}
+
+	return creditCSV.String(), debitCSV.String(), nil
+}
+
+// cleanSheet streams a worksheet row by row and writes the transactions it
+// finds as CSV. Apart from the row being read, only the rows that could still
+// turn out to be part of the footer are held in memory.
+func cleanSheet(f *excelize.File, sheet string, profile Profile, w io.Writer) error {
+	if index, _ := f.GetSheetIndex(sheet); index == -1 {
+		return nil
+	}
+
+	date1904 := false
+	if props, err := f.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		date1904 = *props.Date1904
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+
+	// pending holds rows that may belong to the footer, filled is the number
+	// of pending rows up to and including the last non-empty one. Trailing
+	// empty rows don't count towards the footer.
+	var pending []sheetRow
+	filled := 0
+
+	rowNum := 0
+	for rows.Next() {
+		rowNum++
+		// Raw values keep date serials and unformatted numbers, the cell
+		// formats are undone in writeCleanRow
+		row, err := rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return err
+		}
+		if skipHeaderRow(profile, rowNum) {
+			continue
+		}
+
+		pending = append(pending, sheetRow{num: rowNum, cells: row})
+		if len(row) > 0 {
+			filled = len(pending)
+		}
+
+		// The first pending row has enough filled rows behind it to be
+		// outside the footer
+		for filled > profile.SkipBottom {
+			if err := writeCleanRow(writer, profile, sheet, pending[0], date1904); err != nil {
+				return err
+			}
+			pending = pending[1:]
+			filled--
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return err
+	}
+
+	// The pending rows are the footer. The original cleaner removed it row
+	// by row like the header, so every other one of its rows survived.
+	if !profile.ExactSkip {
+		for i, row := range pending[:filled] {
+			if (profile.SkipBottom-filled+i)%2 == 1 {
+				if err := writeCleanRow(writer, profile, sheet, row, date1904); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// skipHeaderRow reports whether a row is part of the header. The original
+// cleaner removed rows 1 to SkipTop one at a time while the rows below moved
+// up, which removed the odd rows among the first 2×SkipTop.
+func skipHeaderRow(profile Profile, num int) bool {
+	if profile.ExactSkip {
+		return num <= profile.SkipTop
+	}
+	return num < 2*profile.SkipTop && num%2 == 1
+}
+
+// sheetRow is a worksheet row and its 1-based row number.
+type sheetRow struct {
+	num   int
+	cells []string
+}
+
+// SourceRef is the lineage written with each cleaned transaction: the sheet
+// and row it was read from, as in "Sheet1!27".
+func SourceRef(sheet string, row int) string {
+	return fmt.Sprintf("%s!%d", sheet, row)
+}
+
+// ParseSourceRef splits a lineage reference back into sheet and row.
+func ParseSourceRef(ref string) (string, int, bool) {
+	i := strings.LastIndex(ref, "!")
+	if i < 0 {
+		return "", 0, false
+	}
+	row, err := strconv.Atoi(ref[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return ref[:i], row, true
+}
+
+// writeCleanRow extracts the reference, date and amount columns from a
+// worksheet row and writes them in the normalized CSV format, followed by
+// the row's source reference. Rows that are too short or whose date or
+// amount can't be read are skipped, the latter logged to stderr so they
+// don't mix with output on stdout.
+func writeCleanRow(writer *csv.Writer, profile Profile, sheet string, sr sheetRow, date1904 bool) error {
+	row := sr.cells
+	if len(row) < profile.MinColumns {
+		return nil
+	}
+
+	amount, err := ParseAmount(row[profile.AmountColumn], profile.DecimalSeparator)
+	if err != nil {
+		log.Printf("Error parsing amount of %s: %v", SourceRef(sheet, sr.num), err)
+		return nil
+	}
+
+	date, err := normalizeDate(row[profile.DateColumn], profile, date1904)
+	if err != nil {
+		log.Printf("Error parsing date of %s: %v", SourceRef(sheet, sr.num), err)
+		return nil
+	}
+
+	// The side comes from the sheet, so amounts are written unsigned
+	newRow := []string{strings.TrimSpace(row[profile.RefColumn]), date, formatAmount(math.Abs(amount)), SourceRef(sheet, sr.num)}
+	return writer.Write(newRow)
+}
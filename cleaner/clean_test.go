@@ -0,0 +1,191 @@
+package cleaner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// legacyClean is CleanSpreadsheet as it was before the streaming path: it
+// unmerges cells, removes header and footer rows with RemoveRow and reads
+// columns A, Y and AL of the rows left.
+func legacyClean(t *testing.T, filePath string) (string, string) {
+	t.Helper()
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var creditCSV, debitCSV string
+	for _, sheet := range f.GetSheetList() {
+		mergedCells, err := f.GetMergeCells(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mc := range mergedCells {
+			if err := f.UnmergeCell(sheet, mc.GetStartAxis(), mc.GetEndAxis()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 1; i <= 25; i++ {
+			if err := f.RemoveRow(sheet, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lastRow, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := len(lastRow) - 14; i < len(lastRow); i++ {
+			if err := f.RemoveRow(sheet, i+1); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var csvData strings.Builder
+		writer := csv.NewWriter(&csvData)
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if len(row) < 39 {
+				continue
+			}
+			amountStr := strings.TrimPrefix(strings.Replace(row[37], ",", "", -1), "-")
+			amount, err := strconv.ParseFloat(amountStr, 64)
+			if err != nil {
+				continue
+			}
+			writer.Write([]string{row[0], row[24], strconv.FormatFloat(amount, 'f', -1, 64)})
+		}
+		writer.Flush()
+
+		switch sheet {
+		case "Sheet1":
+			creditCSV = csvData.String()
+		case "Sheet2":
+			debitCSV = csvData.String()
+		}
+	}
+	return creditCSV, debitCSV
+}
+
+// writeExport writes a workbook laid out like the ERP export: every row of
+// a sheet filled out to column AM, a merged title, an empty row in the data
+// and a formatted but empty row after the footer.
+func writeExport(t *testing.T, filePath string, rowsPerSheet map[string]int) {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for sheet, count := range rowsPerSheet {
+		if _, err := f.NewSheet(sheet); err != nil {
+			t.Fatal(err)
+		}
+		for n := 1; n <= count; n++ {
+			if n == 40 {
+				continue
+			}
+			row := make([]interface{}, 39)
+			for i := range row {
+				row[i] = "x"
+			}
+			row[0] = fmt.Sprintf("%s-%d", sheet, n)
+			row[24] = fmt.Sprintf("1/%d/2024", n%28+1)
+			row[37] = fmt.Sprintf("%d,%03d.%02d", n, n*7%1000, n%100)
+			if n%5 == 0 {
+				row[37] = "-" + row[37].(string)
+			}
+			if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", n), &row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := f.MergeCell(sheet, "A1", "D2"); err != nil {
+			t.Fatal(err)
+		}
+		style, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.SetRowStyle(sheet, count+3, count+3, style); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reference, date and amount columns of cleaned CSV
+func cleanColumns(t *testing.T, data string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, record := range records {
+		records[i] = record[:3]
+	}
+	return records
+}
+
+func TestCleanSpreadsheetMatchesLegacyPath(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		credit int
+		debit  int
+	}{
+		{"typical", 130, 97},
+		{"no data rows", 39, 45},
+		{"short header", 30, 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "export.xlsx")
+			writeExport(t, filePath, map[string]int{"Sheet1": tc.credit, "Sheet2": tc.debit})
+
+			wantCredit, wantDebit := legacyClean(t, filePath)
+			gotCredit, gotDebit, err := CleanSpreadsheet(filePath, DefaultProfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := cleanColumns(t, gotCredit), cleanColumns(t, wantCredit); !reflect.DeepEqual(got, want) {
+				t.Errorf("credit rows\ngot  %v\nwant %v", got, want)
+			}
+			if got, want := cleanColumns(t, gotDebit), cleanColumns(t, wantDebit); !reflect.DeepEqual(got, want) {
+				t.Errorf("debit rows\ngot  %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCleanSpreadsheetExactSkip(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "export.xlsx")
+	writeExport(t, filePath, map[string]int{"Sheet1": 12, "Sheet2": 6})
+
+	profile := DefaultProfile
+	profile.SkipTop, profile.SkipBottom, profile.ExactSkip = 3, 2, true
+	credit, debit, err := CleanSpreadsheet(filePath, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []string
+	for _, record := range cleanColumns(t, credit) {
+		refs = append(refs, record[0])
+	}
+	want := []string{"Sheet1-4", "Sheet1-5", "Sheet1-6", "Sheet1-7", "Sheet1-8", "Sheet1-9", "Sheet1-10"}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("credit references %v, want %v", refs, want)
+	}
+	if records := cleanColumns(t, debit); len(records) != 1 || records[0][0] != "Sheet2-4" {
+		t.Errorf("debit rows %v, want Sheet2-4 alone", records)
+	}
+}
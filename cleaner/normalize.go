@@ -0,0 +1,143 @@
+package cleaner
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// cleanDateLayout is the date format the reconciler reads from the CSVs.
+const cleanDateLayout = "1/2/2006"
+
+// textDateLayouts are tried in order for dates typed into the sheet as text.
+// Month-first layouts come before day-first ones to match the reconciler.
+var textDateLayouts = []string{
+	"1/2/2006",
+	"1/2/06",
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2-Jan-2006",
+	"2-Jan-06",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2.1.2006",
+}
+
+// normalizeDate turns a raw date cell into the canonical date format. Numeric
+// cells are Excel date serials, anything else is parsed as text, using the
+// profile's layout first when one is set.
+func normalizeDate(raw string, profile Profile, date1904 bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("empty date")
+	}
+
+	if serial, err := strconv.ParseFloat(raw, 64); err == nil {
+		date, err := excelize.ExcelDateToTime(serial, date1904)
+		if err != nil {
+			return "", err
+		}
+		return date.Format(cleanDateLayout), nil
+	}
+
+	layouts := textDateLayouts
+	if profile.DateLayout != "" {
+		layouts = append([]string{profile.DateLayout}, layouts...)
+	}
+	for _, layout := range layouts {
+		if date, err := time.Parse(layout, raw); err == nil {
+			return date.Format(cleanDateLayout), nil
+		}
+	}
+
+	return "", fmt.Errorf("unrecognised date %q", raw)
+}
+
+// ParseAmount parses a raw amount cell. Besides plain numbers it accepts
+// accounting formats: currency symbols or codes, thousands separators,
+// negatives in parentheses or with a trailing minus, and decimal commas.
+// decimalSep is "." or ",", or empty to work it out from the value.
+func ParseAmount(raw string, decimalSep string) (float64, error) {
+	s := strings.TrimSpace(raw)
+	negative := false
+
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+
+	// Drop currency symbols, codes and spaces, keeping digits, separators
+	// and signs
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' || r == '+' {
+			b.WriteRune(r)
+		}
+	}
+	s = b.String()
+
+	if strings.HasSuffix(s, "-") {
+		negative = !negative
+		s = strings.TrimSuffix(s, "-")
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+
+	if decimalSep == "" {
+		decimalSep = guessDecimalSeparator(s)
+	}
+	if decimalSep == "," {
+		s = strings.Replace(s, ".", "", -1)
+		s = strings.Replace(s, ",", ".", 1)
+	} else {
+		s = strings.Replace(s, ",", "", -1)
+	}
+
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unrecognised amount %q", raw)
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+// guessDecimalSeparator picks the decimal separator of a number with
+// thousands separators. When both '.' and ',' appear the last one is the
+// decimal separator. A lone ',' is a decimal comma unless exactly three
+// digits follow it, as in "1,234".
+func guessDecimalSeparator(s string) string {
+	dot := strings.LastIndex(s, ".")
+	comma := strings.LastIndex(s, ",")
+
+	switch {
+	case dot >= 0 && comma >= 0:
+		if comma > dot {
+			return ","
+		}
+		return "."
+	case comma >= 0:
+		if strings.Count(s, ",") == 1 && len(s)-comma-1 != 3 {
+			return ","
+		}
+	}
+
+	return "."
+}
+
+// formatAmount writes an amount rounded to cents without thousands
+// separators or trailing zeros.
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(math.Round(amount*100)/100, 'f', -1, 64)
+}
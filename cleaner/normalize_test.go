@@ -0,0 +1,76 @@
+package cleaner
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		decimal string
+		want    float64
+	}{
+		{"1234.56", "", 1234.56},
+		{"1,234.56", "", 1234.56},
+		{"1.234,56", "", 1234.56},
+		{"1,234", "", 1234},
+		{"12,5", "", 12.5},
+		{"1.234", ",", 1234},
+		{"(1,234.00)", "", -1234},
+		{"99.00-", "", -99},
+		{"-5", "", -5},
+		{"$ -5.00", "", -5},
+		{"€ 1.250,00", "", 1250},
+		{"USD 7.50", "", 7.5},
+		{"+3", "", 3},
+	} {
+		got, err := ParseAmount(tc.raw, tc.decimal)
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %q): %v", tc.raw, tc.decimal, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseAmount(%q, %q) = %v, want %v", tc.raw, tc.decimal, got, tc.want)
+		}
+	}
+
+	for _, raw := range []string{"", "abc", "1.2.3,4,5", "--"} {
+		if got, err := ParseAmount(raw, ""); err == nil {
+			t.Errorf("ParseAmount(%q) = %v, want an error", raw, got)
+		}
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	for _, tc := range []struct {
+		raw      string
+		layout   string
+		date1904 bool
+		want     string
+	}{
+		{"45292", "", false, "1/1/2024"},
+		{"45292.75", "", false, "1/1/2024"},
+		{"43830", "", true, "1/1/2024"},
+		{"1/2/2024", "", false, "1/2/2024"},
+		{"2024-01-02", "", false, "1/2/2024"},
+		{"2-Jan-2024", "", false, "1/2/2024"},
+		{"Jan 2, 2024", "", false, "1/2/2024"},
+		{"02/01/2024", "02/01/2006", false, "1/2/2024"},
+		{" 2.1.2024 ", "", false, "1/2/2024"},
+	} {
+		profile := DefaultProfile
+		profile.DateLayout = tc.layout
+		got, err := normalizeDate(tc.raw, profile, tc.date1904)
+		if err != nil {
+			t.Errorf("normalizeDate(%q): %v", tc.raw, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("normalizeDate(%q) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+
+	for _, raw := range []string{"", "yesterday", "2024-13-01"} {
+		if got, err := normalizeDate(raw, DefaultProfile, false); err == nil {
+			t.Errorf("normalizeDate(%q) = %q, want an error", raw, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Profile describes where the transactions live in an ERP export and
+// which rows around them have to be skipped.
+type Profile struct {
+	Name string
+
+	// Rows to drop from the top (report header) and bottom (totals and
+	// signature block) of each sheet. The footer ends at the last non-empty
+	// row.
+	SkipTop    int
+	SkipBottom int
+
+	// ExactSkip drops exactly SkipTop and SkipBottom rows. Without it rows
+	// are dropped as the RemoveRow loops of the original cleaner did, which
+	// deleted rows while the ones below moved up: of the first 2×SkipTop
+	// rows only the odd ones go, and of the last SkipBottom rows every other
+	// one, starting with the first.
+	ExactSkip bool
+
+	// Rows with fewer cells than this are layout rows, not transactions.
+	MinColumns int
+
+	// Zero-based column indexes of the fields written to the CSV.
+	RefColumn    int
+	DateColumn   int
+	AmountColumn int
+
+	// DateLayout is tried first for dates stored as text. DecimalSeparator
+	// is "." or "," for amounts stored as text, empty to detect it per cell.
+	DateLayout       string
+	DecimalSeparator string
+
+	// Sheets holding the credit and debit side of the books.
+	CreditSheet string
+	DebitSheet  string
+
+	// Password opens protected workbooks when the request doesn't supply
+	// one.
+	Password string
+}
+
+// DefaultProfile matches the layout of the ERP statement export: a 25 row
+// header, 14 footer rows and the amount in column AL.
+var DefaultProfile = Profile{
+	Name:         "default",
+	SkipTop:      25,
+	SkipBottom:   14,
+	MinColumns:   39,
+	RefColumn:    0,  // A
+	DateColumn:   24, // Y
+	AmountColumn: 37, // AL
+	CreditSheet:  "Sheet1",
+	DebitSheet:   "Sheet2",
+}
+
+// ParseProfile reads a profile from JSON. Fields left out keep their
+// DefaultProfile values, so a profile only has to list what differs.
+func ParseProfile(data []byte) (Profile, error) {
+	profile := DefaultProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return Profile{}, err
+	}
+	if err := profile.Validate(); err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// Validate checks that the rows to skip aren't negative and that the
+// columns read lie within MinColumns, so every row that is long enough has
+// them.
+func (p Profile) Validate() error {
+	if p.SkipTop < 0 || p.SkipBottom < 0 {
+		return fmt.Errorf("invalid rows to skip: SkipTop %d and SkipBottom %d can't be negative", p.SkipTop, p.SkipBottom)
+	}
+	for _, column := range []struct {
+		name  string
+		index int
+	}{{"RefColumn", p.RefColumn}, {"DateColumn", p.DateColumn}, {"AmountColumn", p.AmountColumn}} {
+		if column.index < 0 || column.index >= p.MinColumns {
+			return fmt.Errorf("invalid %s %d, expected 0 to MinColumns-1 (%d)", column.name, column.index, p.MinColumns-1)
+		}
+	}
+	return nil
+}
+
+// LoadProfile reads a JSON profile from a file.
+func LoadProfile(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+	return ParseProfile(data)
+}
@@ -0,0 +1,33 @@
+package cleaner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	for _, tc := range []struct {
+		json string
+		err  string
+	}{
+		{json: `{}`},
+		{json: `{"MinColumns": 3, "RefColumn": 0, "DateColumn": 1, "AmountColumn": 2}`},
+		{json: `{"MinColumns": 1, "AmountColumn": 50}`, err: "expected 0 to MinColumns-1 (0)"},
+		{json: `{"AmountColumn": 50}`, err: "invalid AmountColumn 50"},
+		{json: `{"DateColumn": 39}`, err: "invalid DateColumn 39"},
+		{json: `{"RefColumn": -1}`, err: "invalid RefColumn -1"},
+		{json: `{"AmountColumn": -2}`, err: "invalid AmountColumn -2"},
+		{json: `{"MinColumns": 0, "RefColumn": 0, "DateColumn": 0, "AmountColumn": 0}`, err: "invalid RefColumn 0"},
+		{json: `{"SkipTop": -1}`, err: "invalid rows to skip"},
+		{json: `{"SkipBottom": -3}`, err: "invalid rows to skip"},
+		{json: `{"SkipTop": `, err: "unexpected end of JSON input"},
+	} {
+		profile, err := ParseProfile([]byte(tc.json))
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("ParseProfile(%s): %v", tc.json, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("ParseProfile(%s) = %+v, %v; want an error with %q", tc.json, profile, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Settings of the adjustment journal export. Format is one of
+// adjustmentFormats. Accounts maps the roles of the entries to GL accounts:
+// reconciled, residual, unmatched_credit and unmatched_debit. Unmatched
+// selects the unmatched items to write off: "credit", "debit", "all" or
+// transaction numbers. Batch names the journal batch, RECON-<run date> by
+// default.
+type adjustmentConfig struct {
+	Format    string              `json:"format"`
+	Batch     string              `json:"batch"`
+	Accounts  map[string]string   `json:"accounts"`
+	Unmatched []string            `json:"unmatched"`
+	Template  *adjustmentTemplate `json:"template,omitempty"`
+}
+
+// Columns of the template format. Each value is a text/template over an
+// adjustmentRow, e.g. {{.Account}} or {{printf "%.2f" .Amount}}; Date is
+// formatted with DateLayout.
+type adjustmentTemplate struct {
+	Delimiter  string           `json:"delimiter"`
+	DateLayout string           `json:"date_layout"`
+	Columns    []templateColumn `json:"columns"`
+}
+
+type templateColumn struct {
+	Header string `json:"header"`
+	Value  string `json:"value"`
+}
+
+// Roles of the accounts of the adjusting entries
+const (
+	accountReconciled      = "reconciled"
+	accountResidual        = "residual"
+	accountUnmatchedCredit = "unmatched_credit"
+	accountUnmatchedDebit  = "unmatched_debit"
+)
+
+// GL accounts of the roles that the configuration leaves out
+var defaultAdjustmentAccounts = map[string]string{
+	accountReconciled:      "Reconciliation Clearing",
+	accountResidual:        "Reconciliation Differences",
+	accountUnmatchedCredit: "Suspense",
+	accountUnmatchedDebit:  "Suspense",
+}
+
+// Balanced journal entry adjusting one group residual or unmatched item.
+// Amounts of the lines are debits when positive and credits when negative.
+type adjustmentEntry struct {
+	GroupID   string
+	Date      time.Time
+	Reference string
+	Memo      string
+	Lines     []adjustmentLine
+}
+
+type adjustmentLine struct {
+	Account string
+	Amount  float64
+}
+
+// Line of an adjustment as the template format sees it. Debit and Credit
+// are the amount split by sign, both positive.
+type adjustmentRow struct {
+	Batch     string
+	Entry     int
+	GroupID   string
+	Date      string
+	Reference string
+	Account   string
+	Amount    float64
+	Debit     float64
+	Credit    float64
+	Memo      string
+}
+
+// Writer of adjustment entries in a target format
+type adjustmentFormat func(w io.Writer, config adjustmentConfig, entries []adjustmentEntry) error
+
+// Target formats of the adjustment export, by name
+var adjustmentFormats = map[string]adjustmentFormat{
+	"csv":      writeAdjustmentCSV,
+	"iif":      writeAdjustmentIIF,
+	"template": writeAdjustmentTemplate,
+}
+
+// Parse an adjustment configuration and fill in its defaults, taking
+// defaultFormat when it names no format
+func parseAdjustmentConfig(data []byte, defaultFormat string) (adjustmentConfig, error) {
+	var config adjustmentConfig
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, err
+		}
+	}
+
+	if config.Format == "" {
+		config.Format = defaultFormat
+	}
+	if _, ok := adjustmentFormats[config.Format]; !ok {
+		return config, fmt.Errorf("unknown adjustment format %q", config.Format)
+	}
+	if config.Format == "template" {
+		if config.Template == nil || len(config.Template.Columns) == 0 {
+			return config, fmt.Errorf("the template format needs template columns")
+		}
+		if delimiter := config.Template.Delimiter; delimiter != "" {
+			r, size := utf8.DecodeRuneInString(delimiter)
+			if size != len(delimiter) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+				return config, fmt.Errorf("invalid template delimiter %q, expected one character other than a quote or line break", delimiter)
+			}
+		}
+		for _, column := range config.Template.Columns {
+			if _, err := template.New(column.Header).Parse(column.Value); err != nil {
+				return config, fmt.Errorf("column %q: %w", column.Header, err)
+			}
+		}
+	}
+
+	accounts := make(map[string]string, len(defaultAdjustmentAccounts))
+	for role, account := range defaultAdjustmentAccounts {
+		accounts[role] = account
+	}
+	for role, account := range config.Accounts {
+		if _, ok := defaultAdjustmentAccounts[role]; !ok {
+			return config, fmt.Errorf("unknown account role %q", role)
+		}
+		accounts[role] = account
+	}
+	config.Accounts = accounts
+
+	return config, nil
+}
+
+// Read the adjustment configuration for the -adjustments option. Without
+// one the defaults apply. A configuration that names no format takes the
+// one the output file's extension names, iif for .iif and csv otherwise.
+func loadAdjustmentConfig(configPath, outputPath string) (adjustmentConfig, error) {
+	format := "csv"
+	if strings.EqualFold(filepath.Ext(outputPath), ".iif") {
+		format = "iif"
+	}
+	if configPath == "" {
+		return parseAdjustmentConfig(nil, format)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return adjustmentConfig{}, err
+	}
+	return parseAdjustmentConfig(data, format)
+}
+
+// Adjusting entries of a run: one per many-to-one group with a residual,
+// offset to the residual account, and one per selected unmatched item,
+// written off to the unmatched account of its side
+func buildAdjustments(config adjustmentConfig, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) []adjustmentEntry {
+	var entries []adjustmentEntry
+	reconciled := config.Accounts[accountReconciled]
+
+	for _, adjustment := range journalAdjustments(params, matchedTransactions) {
+		transactions := matchedTransactions[adjustment.Index]
+		var members []string
+		for _, transaction := range transactions[1:] {
+			members = append(members, transaction.No)
+		}
+		entries = append(entries, adjustmentEntry{
+			GroupID:   adjustment.GroupID,
+			Date:      adjustment.Date,
+			Reference: transactions[0].No,
+			Memo:      fmt.Sprintf("Residual of match group %s: %s against %s", adjustment.GroupID, transactions[0].No, strings.Join(members, ", ")),
+			Lines: []adjustmentLine{
+				{Account: reconciled, Amount: adjustment.Amount},
+				{Account: config.Accounts[accountResidual], Amount: -adjustment.Amount},
+			},
+		})
+	}
+
+	selected := func(side, no string) bool {
+		for _, selection := range config.Unmatched {
+			if selection == "all" || selection == side || selection == no {
+				return true
+			}
+		}
+		return false
+	}
+	// Credits left on the reconciled account are reversed with a debit, and
+	// debits with a credit
+	writeOff := func(side string, transaction Transaction, sign float64, account string) {
+		if !selected(side, transaction.No) {
+			return
+		}
+		entries = append(entries, adjustmentEntry{
+			Date:      transaction.Date,
+			Reference: transaction.No,
+			Memo:      fmt.Sprintf("Write-off of unmatched %s %s", side, transaction.No),
+			Lines: []adjustmentLine{
+				{Account: reconciled, Amount: roundCents(sign * transaction.Value)},
+				{Account: account, Amount: roundCents(-sign * transaction.Value)},
+			},
+		})
+	}
+	for _, credit := range unmatchedCredits {
+		writeOff("credit", credit.Transaction, 1, config.Accounts[accountUnmatchedCredit])
+	}
+	for _, debit := range unmatchedDebits {
+		writeOff("debit", debit.Transaction, -1, config.Accounts[accountUnmatchedDebit])
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return entries
+}
+
+// Lines of the entries as rows, numbered by entry from 1
+func adjustmentRows(config adjustmentConfig, entries []adjustmentEntry, dateLayout string) []adjustmentRow {
+	var rows []adjustmentRow
+	for i, entry := range entries {
+		for _, line := range entry.Lines {
+			row := adjustmentRow{
+				Batch:     config.Batch,
+				Entry:     i + 1,
+				GroupID:   entry.GroupID,
+				Date:      entry.Date.Format(dateLayout),
+				Reference: entry.Reference,
+				Account:   line.Account,
+				Amount:    line.Amount,
+				Memo:      entry.Memo,
+			}
+			if line.Amount >= 0 {
+				row.Debit = line.Amount
+			} else {
+				row.Credit = -line.Amount
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// Write the entries as a generic journal CSV, a row per line with the debit
+// and credit in separate columns
+func writeAdjustmentCSV(w io.Writer, config adjustmentConfig, entries []adjustmentEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Batch", "Entry", "Date", "Account", "Debit", "Credit", "Reference", "Group", "Memo"}); err != nil {
+		return err
+	}
+	for _, row := range adjustmentRows(config, entries, exportDateLayout) {
+		debit, credit := "", ""
+		if row.Debit != 0 {
+			debit = strconv.FormatFloat(row.Debit, 'f', 2, 64)
+		}
+		if row.Credit != 0 {
+			credit = strconv.FormatFloat(row.Credit, 'f', 2, 64)
+		}
+		if err := writer.Write([]string{row.Batch, strconv.Itoa(row.Entry), row.Date, row.Account, debit, credit, row.Reference, row.GroupID, row.Memo}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Write the entries as QuickBooks IIF general journal transactions: the
+// first line of an entry is its TRNS row and the others SPL rows
+func writeAdjustmentIIF(w io.Writer, config adjustmentConfig, entries []adjustmentEntry) error {
+	var b strings.Builder
+	b.WriteString("!TRNS\tTRNSID\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!SPL\tSPLID\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!ENDTRNS\n")
+
+	// IIF fields can't hold tabs or line breaks
+	clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace
+	for _, entry := range entries {
+		for i, line := range entry.Lines {
+			kind := "SPL"
+			if i == 0 {
+				kind = "TRNS"
+			}
+			fmt.Fprintf(&b, "%s\t\tGENERAL JOURNAL\t%s\t%s\t%.2f\t%s\t%s\n", kind, entry.Date.Format("01/02/2006"), clean(line.Account), line.Amount, clean(entry.Reference), clean(entry.Memo))
+		}
+		b.WriteString("ENDTRNS\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write the entries as a delimited file with the columns of the template
+func writeAdjustmentTemplate(w io.Writer, config adjustmentConfig, entries []adjustmentEntry) error {
+	settings := config.Template
+	columns := make([]*template.Template, len(settings.Columns))
+	header := make([]string, len(settings.Columns))
+	for i, column := range settings.Columns {
+		columns[i] = template.Must(template.New(column.Header).Parse(column.Value))
+		header[i] = column.Header
+	}
+
+	writer := csv.NewWriter(w)
+	if settings.Delimiter != "" {
+		writer.Comma = []rune(settings.Delimiter)[0]
+	}
+	dateLayout := settings.DateLayout
+	if dateLayout == "" {
+		dateLayout = exportDateLayout
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range adjustmentRows(config, entries, dateLayout) {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			var value strings.Builder
+			if err := column.Execute(&value, row); err != nil {
+				return fmt.Errorf("column %q: %w", header[i], err)
+			}
+			record[i] = value.String()
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Write the adjustments of a run in the configured format. The batch is
+// named after the run date unless the configuration names it.
+func writeAdjustments(w io.Writer, config adjustmentConfig, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	if config.Batch == "" {
+		config.Batch = "RECON-" + params.RunAt.Format("20060102")
+	}
+	entries := buildAdjustments(config, params, matchedTransactions, unmatchedCredits, unmatchedDebits)
+	return adjustmentFormats[config.Format](w, config, entries)
+}
+
+// Write the adjustments of a run to a file for the -adjustments-out option
+func writeAdjustmentsFile(filename string, config adjustmentConfig, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeAdjustments(file, config, params, matchedTransactions, unmatchedCredits, unmatchedDebits)
+}
+
+// Name of the adjustments file in a result zip
+func adjustmentFileName(config adjustmentConfig) string {
+	if config.Format == "iif" {
+		return "adjustments.iif"
+	}
+	return "adjustments.csv"
+}
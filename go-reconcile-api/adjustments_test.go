@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAdjustmentConfigFormat(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name, config, output, format string
+	}{
+		{name: "no config", output: "adj.csv", format: "csv"},
+		{name: "no config, iif output", output: "adj.IIF", format: "iif"},
+		{name: "config without format, iif output", config: `{"batch": "B1"}`, output: "adj.iif", format: "iif"},
+		{name: "config without format", config: `{"batch": "B1"}`, output: "adj.txt", format: "csv"},
+		{name: "config format wins", config: `{"format": "csv"}`, output: "adj.iif", format: "csv"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := ""
+			if tc.config != "" {
+				configPath = filepath.Join(dir, "adjustments.json")
+				if err := os.WriteFile(configPath, []byte(tc.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config, err := loadAdjustmentConfig(configPath, tc.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Format != tc.format {
+				t.Errorf("format %q, want %q", config.Format, tc.format)
+			}
+		})
+	}
+}
+
+func TestBuildAdjustments(t *testing.T) {
+	config, err := parseAdjustmentConfig([]byte(`{"unmatched": ["C9"]}`), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched := [][]Transaction{
+		{jan("C1", 5, 100), jan("D1", 5, 100)},
+		{jan("D2", 9, 300), jan("C2", 7, 120), jan("C3", 8, 175)},
+	}
+	unmatchedCredits := []CreditTransaction{{Transaction: jan("C9", 3, 40)}, {Transaction: jan("C8", 4, 10)}}
+
+	entries := buildAdjustments(config, runParameters{}, matched, unmatchedCredits, nil)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want the write-off of C9 and the residual of G0002: %+v", len(entries), entries)
+	}
+	for i, want := range []struct {
+		group, reference string
+		lines            []adjustmentLine
+	}{
+		{reference: "C9", lines: []adjustmentLine{{"Reconciliation Clearing", 40}, {"Suspense", -40}}},
+		{group: "G0002", reference: "D2", lines: []adjustmentLine{{"Reconciliation Clearing", -5}, {"Reconciliation Differences", 5}}},
+	} {
+		entry := entries[i]
+		if entry.GroupID != want.group || entry.Reference != want.reference || len(entry.Lines) != len(want.lines) {
+			t.Fatalf("entry %d: %+v, want %+v", i+1, entry, want)
+		}
+		for j, line := range entry.Lines {
+			if line != want.lines[j] {
+				t.Errorf("entry %d line %d: %+v, want %+v", i+1, j+1, line, want.lines[j])
+			}
+		}
+	}
+}
+
+func TestParseAdjustmentConfigTemplate(t *testing.T) {
+	columns := `"columns": [{"header": "Account", "value": "{{.Account}}"}, {"header": "Amount", "value": "{{printf \"%.2f\" .Amount}}"}]`
+	for _, tc := range []struct {
+		delimiter string
+		err       string
+	}{
+		{delimiter: ``},
+		{delimiter: `;`},
+		{delimiter: `\t`},
+		{delimiter: `\"`, err: "invalid template delimiter"},
+		{delimiter: `\n`, err: "invalid template delimiter"},
+		{delimiter: `\r`, err: "invalid template delimiter"},
+		{delimiter: `;;`, err: "invalid template delimiter"},
+	} {
+		config, err := parseAdjustmentConfig([]byte(`{"format": "template", "template": {"delimiter": "`+tc.delimiter+`", `+columns+`}}`), "csv")
+		if tc.err != "" || err != nil {
+			if err == nil || tc.err == "" || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("delimiter %q: error %v, want %q", tc.delimiter, err, tc.err)
+			}
+			continue
+		}
+
+		var b bytes.Buffer
+		entries := []adjustmentEntry{{Date: jan("", 5, 0).Date, Lines: []adjustmentLine{{"Clearing", 40}, {"Suspense", -40}}}}
+		if err := writeAdjustmentTemplate(&b, config, entries); err != nil {
+			t.Fatalf("delimiter %q: %v", tc.delimiter, err)
+		}
+		delimiter := ","
+		if config.Template.Delimiter != "" {
+			delimiter = config.Template.Delimiter
+		}
+		want := strings.Join([]string{"Account" + delimiter + "Amount", "Clearing" + delimiter + "40.00", "Suspense" + delimiter + "-40.00", ""}, "\n")
+		if b.String() != want {
+			t.Errorf("delimiter %q: wrote %q, want %q", tc.delimiter, b.String(), want)
+		}
+	}
+}
+
+func TestPipelineHandlerChecksAdjustmentsBeforeLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	decisionLog = newDecisionLog(path)
+	t.Cleanup(func() { decisionLog = nil })
+
+	statement := []byte(`<OFX><BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>100.00<FITID>F1</STMTTRN>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>-100.00<FITID>F2</STMTTRN>
+</BANKTRANLIST></OFX>`)
+	rec := postForm(t, pipelineHandler, []formFile{{"file", "stmt.ofx", statement}}, map[string]string{"days": "7", "threshold": "0", "adjustments": `{"format": "xml"}`})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Invalid adjustment configuration") {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the decision log was written")
+	}
+}
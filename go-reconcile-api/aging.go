@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bounds in days of the default aging buckets: 0-30, 31-60, 61-90 and
+// over 90
+var defaultAgingBuckets = []int{30, 60, 90}
+
+// Aging of the unmatched items of a run on the as-of date
+type agingAnalysis struct {
+	AsOf    string        `json:"as_of"`
+	Buckets []agingBucket `json:"buckets"`
+}
+
+// Bucket of the aging analysis. MaxDays is absent for the last bucket,
+// which holds everything older than the one before it.
+type agingBucket struct {
+	Label       string  `json:"label"`
+	MinDays     int     `json:"min_days"`
+	MaxDays     *int    `json:"max_days,omitempty"`
+	CreditCount int     `json:"credit_count"`
+	CreditTotal float64 `json:"credit_total"`
+	DebitCount  int     `json:"debit_count"`
+	DebitTotal  float64 `json:"debit_total"`
+}
+
+// Parse the upper bounds of the aging buckets from a comma-separated list of
+// increasing day counts, e.g. 30,60,90
+func parseAgingBuckets(value string) ([]int, error) {
+	var bounds []int
+	for _, part := range strings.Split(value, ",") {
+		bound, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || bound < 0 {
+			return nil, fmt.Errorf("invalid aging bucket %q", part)
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("aging buckets must increase, got %d after %d", bound, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// Read the "as_of" date (YYYY-MM-DD) and "aging" buckets query parameters of
+// a request into the run parameters
+func parseAgingQuery(r *http.Request, params *runParameters) error {
+	query := r.URL.Query()
+	if value := query.Get("as_of"); value != "" {
+		if _, err := time.Parse(exportDateLayout, value); err != nil {
+			return fmt.Errorf("invalid as_of date %q", value)
+		}
+		params.AsOf = value
+	}
+	if value := query.Get("aging"); value != "" {
+		bounds, err := parseAgingBuckets(value)
+		if err != nil {
+			return err
+		}
+		params.AgingBuckets = bounds
+	}
+	return nil
+}
+
+// Bucket the unmatched items of a run by their age on the as-of date of the
+// parameters, the run date when none is set. Items dated after the as-of
+// date count as 0 days old.
+func analyzeAging(params runParameters, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) agingAnalysis {
+	asOf := params.RunAt
+	if date, err := time.Parse(exportDateLayout, params.AsOf); err == nil {
+		asOf = date
+	}
+	bounds := params.AgingBuckets
+	if len(bounds) == 0 {
+		bounds = defaultAgingBuckets
+	}
+
+	analysis := agingAnalysis{AsOf: asOf.Format(exportDateLayout)}
+	from := 0
+	for i := range bounds {
+		analysis.Buckets = append(analysis.Buckets, agingBucket{
+			Label:   fmt.Sprintf("%d-%d", from, bounds[i]),
+			MinDays: from,
+			MaxDays: &bounds[i],
+		})
+		from = bounds[i] + 1
+	}
+	analysis.Buckets = append(analysis.Buckets, agingBucket{
+		Label:   fmt.Sprintf("Over %d", bounds[len(bounds)-1]),
+		MinDays: from,
+	})
+
+	bucketFor := func(transaction Transaction) *agingBucket {
+		age := max(dateDifferenceInDays(asOf, transaction.Date), 0)
+		for i := range bounds {
+			if age <= bounds[i] {
+				return &analysis.Buckets[i]
+			}
+		}
+		return &analysis.Buckets[len(bounds)]
+	}
+
+	for _, credit := range unmatchedCredits {
+		bucket := bucketFor(credit.Transaction)
+		bucket.CreditCount++
+		bucket.CreditTotal += credit.Value
+	}
+	for _, debit := range unmatchedDebits {
+		bucket := bucketFor(debit.Transaction)
+		bucket.DebitCount++
+		bucket.DebitTotal += debit.Value
+	}
+	for i := range analysis.Buckets {
+		analysis.Buckets[i].CreditTotal = roundCents(analysis.Buckets[i].CreditTotal)
+		analysis.Buckets[i].DebitTotal = roundCents(analysis.Buckets[i].DebitTotal)
+	}
+
+	return analysis
+}
+
+// Format the aging analysis as a text table
+func formatAging(analysis agingAnalysis) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Aging of Unmatched Transactions as of %s:\n", analysis.AsOf)
+	fmt.Fprintf(&b, "%-12s %8s %16s %8s %16s\n", "Days", "Credits", "Credit Total", "Debits", "Debit Total")
+
+	var creditCount, debitCount int
+	var creditTotal, debitTotal float64
+	for _, bucket := range analysis.Buckets {
+		fmt.Fprintf(&b, "%-12s %8d %16s %8d %16s\n", bucket.Label, bucket.CreditCount, formatMoney(bucket.CreditTotal), bucket.DebitCount, formatMoney(bucket.DebitTotal))
+		creditCount += bucket.CreditCount
+		creditTotal += bucket.CreditTotal
+		debitCount += bucket.DebitCount
+		debitTotal += bucket.DebitTotal
+	}
+	fmt.Fprintf(&b, "%-12s %8d %16s %8d %16s\n", "Total", creditCount, formatMoney(creditTotal), debitCount, formatMoney(debitTotal))
+
+	return b.String()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin/cleaner"
+	"github.com/xuri/excelize/v2"
+)
+
+// Match status of a source row
+const (
+	statusMatched   = "matched"
+	statusPartial   = "partial"
+	statusUnmatched = "unmatched"
+)
+
+// Match result written next to a source row
+type rowAnnotation struct {
+	Group    string
+	Status   string
+	Residual float64
+}
+
+// Fill colors of the annotation columns per status
+var statusFills = []struct {
+	status string
+	color  string
+}{
+	{statusMatched, "C6EFCE"},
+	{statusPartial, "FFEB9C"},
+	{statusUnmatched, "FFC7CE"},
+}
+
+// Collect the match results of every transaction that has a source row,
+// grouped by sheet and keyed by row number. Groups with a residual are
+// partial matches, unmatched transactions carry their whole value as the
+// residual.
+func collectAnnotations(matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) map[string]map[int]rowAnnotation {
+	annotations := make(map[string]map[int]rowAnnotation)
+	add := func(transaction Transaction, annotation rowAnnotation) {
+		sheet, row, ok := cleaner.ParseSourceRef(transaction.Source)
+		if !ok {
+			return
+		}
+		if annotations[sheet] == nil {
+			annotations[sheet] = make(map[int]rowAnnotation)
+		}
+		annotations[sheet][row] = annotation
+	}
+
+	for i, transactions := range matchedTransactions {
+		residual := groupResidual(transactions)
+		status := statusMatched
+		if residual != 0 {
+			status = statusPartial
+		}
+		for _, transaction := range transactions {
+			add(transaction, rowAnnotation{Group: matchGroupID(i), Status: status, Residual: residual})
+		}
+	}
+
+	for _, credit := range unmatchedCredits {
+		add(credit.Transaction, rowAnnotation{Status: statusUnmatched, Residual: credit.Value})
+	}
+	for _, debit := range unmatchedDebits {
+		add(debit.Transaction, rowAnnotation{Status: statusUnmatched, Residual: debit.Value})
+	}
+
+	return annotations
+}
+
+// Write the match results into a copy of the source workbook. Each sheet
+// with cleaned rows gets Match Group, Match Status and Residual columns
+// after its last used column, on the rows the source references of the
+// transactions name, with the headers on the row above the first of them.
+// The copy keeps the source's password.
+func annotateWorkbook(workbook io.Reader, password string, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, w io.Writer) error {
+	f, err := excelize.OpenReader(workbook, excelize.Options{Password: password})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	annotations := collectAnnotations(matchedTransactions, unmatchedCredits, unmatchedDebits)
+
+	for sheet, rows := range annotations {
+		if index, _ := f.GetSheetIndex(sheet); index == -1 {
+			continue
+		}
+		if err := annotateSheet(f, sheet, rows); err != nil {
+			return fmt.Errorf("annotating %s: %w", sheet, err)
+		}
+	}
+
+	return f.Write(w, excelize.Options{Password: password})
+}
+
+// Add the annotation columns to one sheet. The header rows the cleaner
+// skipped depend on the profile, so the headers go right above the first
+// source row instead.
+func annotateSheet(f *excelize.File, sheet string, rows map[int]rowAnnotation) error {
+	lastCol, err := lastColumn(f, sheet)
+	if err != nil {
+		return err
+	}
+	groupCol, statusCol, residualCol := lastCol+1, lastCol+2, lastCol+3
+
+	rowNums := make([]int, 0, len(rows))
+	for row := range rows {
+		rowNums = append(rowNums, row)
+	}
+	sort.Ints(rowNums)
+
+	if headerRow := rowNums[0] - 1; headerRow > 0 {
+		for col, header := range map[int]string{groupCol: "Match Group", statusCol: "Match Status", residualCol: "Residual"} {
+			cell, _ := excelize.CoordinatesToCellName(col, headerRow)
+			if err := f.SetCellValue(sheet, cell, header); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, row := range rowNums {
+		annotation := rows[row]
+		values := []interface{}{annotation.Group, annotation.Status, annotation.Residual}
+		for i, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(groupCol+i, row)
+			if err := f.SetCellValue(sheet, cell, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Fill the three columns by the status of each row
+	first, _ := excelize.CoordinatesToCellName(groupCol, rowNums[0])
+	last, _ := excelize.CoordinatesToCellName(residualCol, rowNums[len(rowNums)-1])
+	statusColName, _ := excelize.ColumnNumberToName(statusCol)
+
+	var formats []excelize.ConditionalFormatOptions
+	for _, fill := range statusFills {
+		style, err := f.NewConditionalStyle(&excelize.Style{
+			Fill: excelize.Fill{Type: "pattern", Color: []string{fill.color}, Pattern: 1},
+		})
+		if err != nil {
+			return err
+		}
+		formats = append(formats, excelize.ConditionalFormatOptions{
+			Type:     "formula",
+			Format:   style,
+			Criteria: fmt.Sprintf(`$%s%d="%s"`, statusColName, rowNums[0], fill.status),
+		})
+	}
+
+	return f.SetConditionalFormat(sheet, first+":"+last, formats)
+}
+
+// Number of the last used column of a sheet, taken from its dimension or,
+// when the sheet doesn't record one, from its widest row
+func lastColumn(f *excelize.File, sheet string) (int, error) {
+	dimension, err := f.GetSheetDimension(sheet)
+	if err != nil {
+		return 0, err
+	}
+	if _, ref, ok := strings.Cut(dimension, ":"); ok {
+		if col, _, err := excelize.CellNameToCoordinates(ref); err == nil {
+			return col, nil
+		}
+	}
+
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return 0, err
+	}
+	lastCol := 0
+	for _, row := range rows {
+		if len(row) > lastCol {
+			lastCol = len(row)
+		}
+	}
+	return lastCol, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gin-gonic/gin/cleaner"
+	"github.com/gin-gonic/gin/ingest"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestAnnotateWorkbookFollowsSourceRows(t *testing.T) {
+	// Without ExactSkip a SkipTop of 2 drops rows 1 and 3 and keeps row 2,
+	// too short to be a transaction, so the data starts on row 4
+	preamble := [][]interface{}{{"Statement export"}, {"January"}, {"Reference", "Date", "Amount"}}
+	workbook := sheetsWorkbook(t, map[string][][]interface{}{
+		"Sheet1": append(preamble, []interface{}{"C1", "2024-01-05", 100}, []interface{}{"C2", "2024-01-06", 50}),
+		"Sheet2": append(preamble, []interface{}{"D1", "2024-01-05", 100}),
+	})
+	profile := cleaner.Profile{SkipTop: 2, MinColumns: 3, RefColumn: 0, DateColumn: 1, AmountColumn: 2, CreditSheet: "Sheet1", DebitSheet: "Sheet2"}
+
+	document, err := ingest.Parse("export.xlsx", workbook, ingest.Options{Profile: &profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, unmatchedCredits, unmatchedDebits := reconcileTransactions(documentTransactions(document, "credit", false), documentTransactions(document, "debit", false), 7, 0)
+
+	var annotated bytes.Buffer
+	if err := annotateWorkbook(bytes.NewReader(workbook), "", matched, unmatchedCredits, unmatchedDebits, &annotated); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, tc := range []struct {
+		sheet, cell, want string
+	}{
+		{"Sheet1", "D2", ""},
+		{"Sheet1", "D3", "Match Group"},
+		{"Sheet1", "E3", "Match Status"},
+		{"Sheet1", "F3", "Residual"},
+		{"Sheet1", "D4", "G0001"},
+		{"Sheet1", "E4", statusMatched},
+		{"Sheet1", "E5", statusUnmatched},
+		{"Sheet1", "F5", "50"},
+		{"Sheet2", "D3", "Match Group"},
+		{"Sheet2", "D4", "G0001"},
+		{"Sheet2", "E4", statusMatched},
+	} {
+		if got, err := f.GetCellValue(tc.sheet, tc.cell); err != nil || got != tc.want {
+			t.Errorf("%s!%s = %q, %v; want %q", tc.sheet, tc.cell, got, err, tc.want)
+		}
+	}
+}
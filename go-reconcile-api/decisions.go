@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Reasons a candidate of a match was passed over
+const (
+	rejectAmount          = "amount"
+	rejectDateWindow      = "date_window"
+	rejectAlreadyConsumed = "already_consumed"
+)
+
+// Entry of the decision log. A run starts with a "run" entry holding its
+// parameters, followed by a "match" entry per matched group and a "no-match"
+// entry per debit whose many-to-one attempt fell outside the threshold.
+// Subject is the transaction the matcher was placing and Candidates the
+// transactions it examined for it, in order. Seq counts the entries of the
+// log and Hash is the SHA-256 of the entry without its hash, which covers
+// PrevHash, the hash of the entry before it.
+type decisionEntry struct {
+	RunID      string              `json:"run_id"`
+	Seq        int                 `json:"seq"`
+	Event      string              `json:"event"`
+	Parameters *runParameters      `json:"parameters,omitempty"`
+	Rule       string              `json:"rule,omitempty"`
+	GroupID    string              `json:"group_id,omitempty"`
+	Subject    *resultTransaction  `json:"subject,omitempty"`
+	Members    []resultTransaction `json:"members,omitempty"`
+	Candidates []decisionCandidate `json:"candidates,omitempty"`
+	Residual   *float64            `json:"residual,omitempty"`
+	PrevHash   string              `json:"prev_hash"`
+	Hash       string              `json:"hash,omitempty"`
+}
+
+// Transaction examined for a match: chosen, or rejected for Reason
+type decisionCandidate struct {
+	resultTransaction
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Transaction of a trace with its side
+type tracedTransaction struct {
+	side string
+	Transaction
+}
+
+// Decisions of one reconcile, recorded as it goes. A nil trace records
+// nothing, so reconcile can call it unconditionally.
+type decisionTrace struct {
+	entries  []decisionEntry
+	current  *decisionEntry
+	consumed []tracedTransaction
+	groups   int
+}
+
+func newDecisionTrace() *decisionTrace {
+	return &decisionTrace{}
+}
+
+// Start the decision on the placement of subject
+func (t *decisionTrace) begin(side string, subject Transaction) {
+	if t == nil {
+		return
+	}
+	t.current = &decisionEntry{Subject: &resultTransactions([]Transaction{subject}, side)[0]}
+}
+
+// Record a candidate of the current decision, chosen when reason is empty
+func (t *decisionTrace) examine(side string, candidate Transaction, reason string) {
+	if t == nil || t.current == nil {
+		return
+	}
+	outcome := "chosen"
+	if reason != "" {
+		outcome = "rejected"
+	}
+	t.current.Candidates = append(t.current.Candidates, decisionCandidate{
+		resultTransaction: resultTransactions([]Transaction{candidate}, side)[0],
+		Outcome:           outcome,
+		Reason:            reason,
+	})
+}
+
+// Record the transactions of side that earlier matches took but that would
+// otherwise have been candidates of the current decision
+func (t *decisionTrace) examineConsumed(side string, eligible func(Transaction) bool) {
+	if t == nil || t.current == nil {
+		return
+	}
+	for _, transaction := range t.consumed {
+		if transaction.side == side && eligible(transaction.Transaction) {
+			t.examine(side, transaction.Transaction, rejectAlreadyConsumed)
+		}
+	}
+}
+
+// Close the current decision with the group it matched, the next group of
+// the run
+func (t *decisionTrace) match(transactions []Transaction) {
+	if t == nil || t.current == nil {
+		return
+	}
+	entry := t.current
+	entry.Event = "match"
+	entry.Rule = matchRule(transactions)
+	entry.GroupID = matchGroupID(t.groups)
+	for i, side := range groupSides(transactions) {
+		entry.Members = append(entry.Members, resultTransactions(transactions[i:i+1], side)[0])
+		t.consumed = append(t.consumed, tracedTransaction{side: side, Transaction: transactions[i]})
+	}
+	residual := roundCents(groupResidual(transactions))
+	entry.Residual = &residual
+
+	t.groups++
+	t.entries = append(t.entries, *entry)
+	t.current = nil
+}
+
+// Close the current decision without a match, residual short of the subject
+func (t *decisionTrace) noMatch(rule string, residual float64) {
+	if t == nil || t.current == nil {
+		return
+	}
+	entry := t.current
+	entry.Event = "no-match"
+	entry.Rule = rule
+	residual = roundCents(residual)
+	entry.Residual = &residual
+
+	t.entries = append(t.entries, *entry)
+	t.current = nil
+}
+
+// Drop the current decision, for subjects left to the next pass
+func (t *decisionTrace) discard() {
+	if t == nil {
+		return
+	}
+	t.current = nil
+}
+
+// Append-only decision log in JSON Lines, configured with -decision-log
+type decisionLogFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Decision log configured with -decision-log, nil without it
+var decisionLog *decisionLogFile
+
+func newDecisionLog(path string) *decisionLogFile {
+	return &decisionLogFile{path: path}
+}
+
+// Random ID of a run
+func newRunID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Append the decisions of a run to the log, chained to its last entry
+func (l *decisionLogFile) append(params runParameters, trace *decisionTrace) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seq, prevHash, err := l.last()
+	if err != nil {
+		return err
+	}
+
+	entries := append([]decisionEntry{{Event: "run", Parameters: &params}}, trace.entries...)
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		seq++
+		entry.RunID = params.RunID
+		entry.Seq = seq
+		entry.PrevHash = prevHash
+		line, hash, err := sealDecision(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		prevHash = hash
+	}
+
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Sequence number and hash of the last entry of the log, zero and empty
+// when there's none yet
+func (l *decisionLogFile) last() (int, string, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, "", err
+	}
+	if last == nil {
+		return 0, "", nil
+	}
+
+	var entry decisionEntry
+	if err := json.Unmarshal(last, &entry); err != nil {
+		return 0, "", fmt.Errorf("reading last decision: %w", err)
+	}
+	return entry.Seq, entry.Hash, nil
+}
+
+// Marker of the hash at the end of a log line
+var hashField = []byte(`,"hash":"`)
+
+// Encode an entry as a log line. The hash is taken over the entry encoded
+// without it and then appended as its last field, so verifying a line only
+// needs its bytes.
+func sealDecision(entry decisionEntry) ([]byte, string, error) {
+	entry.Hash = ""
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	line := append(body[:len(body)-1:len(body)-1], hashField...)
+	line = append(line, hash...)
+	line = append(line, '"', '}')
+	return line, hash, nil
+}
+
+// Check the hash chain of a decision log and return the number of entries.
+// The error names the first line that was altered, removed or reordered.
+func verifyDecisionLog(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+
+	count, prevHash := 0, ""
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		i := bytes.LastIndex(line, hashField)
+		if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+			return count, fmt.Errorf("line %d: no hash", lineNo)
+		}
+		body := append(line[:i:i], '}')
+		hash := string(line[i+len(hashField) : len(line)-2])
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != hash {
+			return count, fmt.Errorf("line %d: hash mismatch, the entry was altered", lineNo)
+		}
+
+		var entry decisionEntry
+		if err := json.Unmarshal(body, &entry); err != nil {
+			return count, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if entry.PrevHash != prevHash || entry.Seq != count+1 {
+			return count, fmt.Errorf("line %d: broken chain, entries before it were altered, removed or reordered", lineNo)
+		}
+
+		count++
+		prevHash = hash
+	}
+	return count, scanner.Err()
+}
+
+// Check the decision log at path for the -verify-log command-line option
+func verifyDecisionLogFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return verifyDecisionLog(file)
+}
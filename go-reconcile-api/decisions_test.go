@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecisionLogHashChain(t *testing.T) {
+	decisions := newDecisionLog(filepath.Join(t.TempDir(), "decisions.jsonl"))
+
+	credits := []Transaction{jan("C1", 5, 100), jan("C2", 6, 60), jan("C3", 6, 38)}
+	debits := []Transaction{jan("D1", 6, 100), jan("D2", 7, 100)}
+	for run := 0; run < 2; run++ {
+		params := runParameters{RunID: newRunID(), Days: 7, Threshold: 5, RunAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+		trace := newDecisionTrace()
+		reconcileTraced(credits, debits, params.Days, params.Threshold, trace)
+		if err := decisions.append(params, trace); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(decisions.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A run entry and a match entry for each of the two groups, twice
+	if count, err := verifyDecisionLog(bytes.NewReader(data)); err != nil || count != 6 {
+		t.Fatalf("verified %d entries, error %v, want 6", count, err)
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		err   string
+	}{
+		{
+			name:  "altered",
+			lines: append([]string{strings.Replace(lines[0], `"days":7`, `"days":8`, 1)}, lines[1:]...),
+			err:   "line 1: hash mismatch",
+		},
+		{
+			name:  "removed",
+			lines: append([]string{lines[0]}, lines[2:]...),
+			err:   "line 2: broken chain",
+		},
+		{
+			name:  "reordered",
+			lines: append([]string{lines[1], lines[0]}, lines[2:]...),
+			err:   "line 1: broken chain",
+		},
+		{
+			name:  "hash stripped",
+			lines: []string{lines[0][:strings.LastIndex(lines[0], `,"hash"`)] + "}\n"},
+			err:   "line 1: no hash",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyDecisionLog(strings.NewReader(strings.Join(tc.lines, "")))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("error %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
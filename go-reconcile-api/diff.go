@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Comparison of two saved JSON results. Transactions are identified across
+// the runs by side, number, date and amount, and groups by their members.
+// The net effects are the change in the matched credit and debit totals,
+// except for added and removed items, where they're the change in the
+// totals of the input.
+type resultDiff struct {
+	Old          runParameters `json:"old"`
+	New          runParameters `json:"new"`
+	NewlyMatched diffGroups    `json:"newly_matched"`
+	Broken       diffGroups    `json:"broken"`
+	PartlyBroken diffGroups    `json:"partly_broken"`
+	Regrouped    diffGroups    `json:"regrouped"`
+	NowMatched   diffItems     `json:"now_matched"`
+	NowUnmatched diffItems     `json:"now_unmatched"`
+	Added        diffItems     `json:"added"`
+	Removed      diffItems     `json:"removed"`
+}
+
+// Groups of one category of the comparison. Newly matched and regrouped
+// groups are those of the new run, broken and partly broken groups those of
+// the old one.
+type diffGroups struct {
+	Count     int           `json:"count"`
+	NetCredit float64       `json:"net_credit"`
+	NetDebit  float64       `json:"net_debit"`
+	Groups    []resultGroup `json:"groups"`
+}
+
+// Transactions of one category of the comparison
+type diffItems struct {
+	Count     int                 `json:"count"`
+	NetCredit float64             `json:"net_credit"`
+	NetDebit  float64             `json:"net_debit"`
+	Items     []resultTransaction `json:"items"`
+}
+
+// Read a saved JSON result. Every matched group needs members, each of them
+// a credit or a debit.
+func loadResult(r io.Reader) (reconResult, error) {
+	var result reconResult
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return result, err
+	}
+	if result.SchemaVersion != resultSchemaVersion {
+		return result, fmt.Errorf("unsupported result schema version %q", result.SchemaVersion)
+	}
+	for i, group := range result.MatchedGroups {
+		if len(group.Members) == 0 {
+			return result, fmt.Errorf("matched group %d (%s) has no members", i+1, group.ID)
+		}
+		for _, member := range group.Members {
+			if member.Side != "credit" && member.Side != "debit" {
+				return result, fmt.Errorf("matched group %d (%s) has a member with side %q", i+1, group.ID, member.Side)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Read a saved JSON result from disk
+func loadResultFile(path string) (reconResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return reconResult{}, err
+	}
+	defer file.Close()
+
+	result, err := loadResult(file)
+	if err != nil {
+		return result, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return result, nil
+}
+
+// Write the JSON result of a run to a file for the -result command-line
+// option
+func writeResultFile(filename string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	body, err := json.MarshalIndent(buildResult(params, matchedTransactions, unmatchedCredits, unmatchedDebits, nil), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, body, 0644)
+}
+
+// Identity of a transaction across runs, see lineageID
+func transactionKey(transaction resultTransaction) string {
+	return fmt.Sprintf("%s:%s:%s:%.2f", transaction.Side, transaction.No, transaction.Date, transaction.Amount)
+}
+
+// Identity of a group across runs: the sorted keys of its members
+func groupKey(group resultGroup) string {
+	keys := make([]string, len(group.Members))
+	for i, member := range group.Members {
+		keys[i] = transactionKey(member)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "|")
+}
+
+// Transactions of a run, matched and unmatched
+func runTransactions(result reconResult) []resultTransaction {
+	var transactions []resultTransaction
+	for _, group := range result.MatchedGroups {
+		transactions = append(transactions, group.Members...)
+	}
+	transactions = append(transactions, result.UnmatchedCredits...)
+	return append(transactions, result.UnmatchedDebits...)
+}
+
+// Where each transaction of a run ended up: the key of its group, or empty
+// when it's unmatched
+func transactionPlacement(result reconResult) map[string]string {
+	placement := make(map[string]string)
+	for _, group := range result.MatchedGroups {
+		key := groupKey(group)
+		for _, member := range group.Members {
+			placement[transactionKey(member)] = key
+		}
+	}
+	for _, transaction := range result.UnmatchedCredits {
+		placement[transactionKey(transaction)] = ""
+	}
+	for _, transaction := range result.UnmatchedDebits {
+		placement[transactionKey(transaction)] = ""
+	}
+	return placement
+}
+
+func (d *diffGroups) add(group resultGroup, sign float64, counts func(resultTransaction) bool) {
+	d.Count++
+	d.Groups = append(d.Groups, group)
+	for _, member := range group.Members {
+		if !counts(member) {
+			continue
+		}
+		if member.Side == "credit" {
+			d.NetCredit = roundCents(d.NetCredit + sign*member.Amount)
+		} else {
+			d.NetDebit = roundCents(d.NetDebit + sign*member.Amount)
+		}
+	}
+}
+
+func (d *diffItems) add(transaction resultTransaction, sign float64) {
+	d.Count++
+	d.Items = append(d.Items, transaction)
+	if transaction.Side == "credit" {
+		d.NetCredit = roundCents(d.NetCredit + sign*transaction.Amount)
+	} else {
+		d.NetDebit = roundCents(d.NetDebit + sign*transaction.Amount)
+	}
+}
+
+// Compare two results. A group of the new run that the old run didn't have is
+// newly matched when none of its members were matched before and regrouped
+// otherwise. An old group whose members are all unmatched or gone in the new
+// run is broken; one that lost only some of them while the others were
+// matched into other groups is partly broken, and only the members it lost
+// change its totals.
+func diffResults(oldResult, newResult reconResult) resultDiff {
+	diff := resultDiff{Old: oldResult.Parameters, New: newResult.Parameters}
+	for _, groups := range []*diffGroups{&diff.NewlyMatched, &diff.Broken, &diff.PartlyBroken, &diff.Regrouped} {
+		groups.Groups = []resultGroup{}
+	}
+	for _, items := range []*diffItems{&diff.NowMatched, &diff.NowUnmatched, &diff.Added, &diff.Removed} {
+		items.Items = []resultTransaction{}
+	}
+	oldPlacement, newPlacement := transactionPlacement(oldResult), transactionPlacement(newResult)
+
+	all := func(_ resultTransaction) bool { return true }
+
+	for _, group := range newResult.MatchedGroups {
+		key := groupKey(group)
+		regrouped := false
+		for _, member := range group.Members {
+			if oldKey := oldPlacement[transactionKey(member)]; oldKey != "" && oldKey != key {
+				regrouped = true
+			}
+		}
+		switch {
+		case regrouped:
+			// Only the members that weren't matched before change the totals
+			diff.Regrouped.add(group, 1, func(member resultTransaction) bool {
+				return oldPlacement[transactionKey(member)] == ""
+			})
+		case oldPlacement[transactionKey(group.Members[0])] != key:
+			diff.NewlyMatched.add(group, 1, all)
+		}
+	}
+
+	lost := func(member resultTransaction) bool {
+		return newPlacement[transactionKey(member)] == ""
+	}
+	for _, group := range oldResult.MatchedGroups {
+		lostCount := 0
+		for _, member := range group.Members {
+			if lost(member) {
+				lostCount++
+			}
+		}
+		switch {
+		case lostCount == len(group.Members):
+			diff.Broken.add(group, -1, all)
+		case lostCount > 0:
+			diff.PartlyBroken.add(group, -1, lost)
+		}
+	}
+
+	for _, transaction := range runTransactions(oldResult) {
+		key := transactionKey(transaction)
+		newGroup, ok := newPlacement[key]
+		switch {
+		case !ok:
+			diff.Removed.add(transaction, -1)
+		case oldPlacement[key] != "" && newGroup == "":
+			diff.NowUnmatched.add(transaction, -1)
+		}
+	}
+	for _, transaction := range runTransactions(newResult) {
+		key := transactionKey(transaction)
+		oldGroup, ok := oldPlacement[key]
+		switch {
+		case !ok:
+			diff.Added.add(transaction, 1)
+		case oldGroup == "" && newPlacement[key] != "":
+			diff.NowMatched.add(transaction, 1)
+		}
+	}
+
+	return diff
+}
+
+// Format the comparison as text
+func formatDiff(diff resultDiff) string {
+	var b strings.Builder
+
+	b.WriteString("Comparison of Reconciliation Runs\n")
+	for _, run := range []struct {
+		label  string
+		params runParameters
+	}{{"Old", diff.Old}, {"New", diff.New}} {
+		var inputs []string
+		for _, input := range run.params.Inputs {
+			inputs = append(inputs, input.Name)
+		}
+		fmt.Fprintf(&b, "%s: run at %s, days %d, threshold %.2f, inputs %s\n", run.label, run.params.RunAt.Format("2006-01-02 15:04:05 MST"), run.params.Days, run.params.Threshold, strings.Join(inputs, ", "))
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "%-24s %6s %16s %16s\n", "", "Count", "Net Credits", "Net Debits")
+	groups := []struct {
+		label string
+		d     diffGroups
+	}{
+		{"Newly matched groups", diff.NewlyMatched},
+		{"Broken groups", diff.Broken},
+		{"Partly broken groups", diff.PartlyBroken},
+		{"Regrouped groups", diff.Regrouped},
+	}
+	for _, g := range groups {
+		fmt.Fprintf(&b, "%-24s %6d %16s %16s\n", g.label, g.d.Count, formatMoney(g.d.NetCredit), formatMoney(g.d.NetDebit))
+	}
+	items := []struct {
+		label string
+		d     diffItems
+	}{
+		{"Unmatched to matched", diff.NowMatched},
+		{"Matched to unmatched", diff.NowUnmatched},
+		{"Added transactions", diff.Added},
+		{"Removed transactions", diff.Removed},
+	}
+	for _, i := range items {
+		fmt.Fprintf(&b, "%-24s %6d %16s %16s\n", i.label, i.d.Count, formatMoney(i.d.NetCredit), formatMoney(i.d.NetDebit))
+	}
+
+	for _, g := range groups {
+		if g.d.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", g.label)
+		for _, group := range g.d.Groups {
+			var members []string
+			for _, member := range group.Members {
+				members = append(members, fmt.Sprintf("%s %s (%.2f)", member.Side, member.No, member.Amount))
+			}
+			fmt.Fprintf(&b, "%s %s: %s\n", group.ID, group.Rule, strings.Join(members, ", "))
+		}
+	}
+	for _, i := range items {
+		if i.d.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", i.label)
+		for _, item := range i.d.Items {
+			fmt.Fprintf(&b, "%s %s, %s, %.2f\n", item.Side, item.No, item.Date, item.Amount)
+		}
+	}
+
+	return b.String()
+}
+
+// Handler that compares two saved JSON results, uploaded as "old" and
+// "new". The response is the comparison as JSON, or as text when the Accept
+// header doesn't ask for JSON.
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var results [2]reconResult
+	for i, field := range []string{"old", "new"} {
+		file, _, err := r.FormFile(field)
+		if err != nil {
+			http.Error(w, "Error retrieving "+field+" result", http.StatusBadRequest)
+			return
+		}
+		results[i], err = loadResult(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "Invalid "+field+" result: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	diff := diffResults(results[0], results[1])
+
+	w.Header().Add("Vary", "Accept")
+	if negotiateResultFormat(r) == mediaJSON {
+		body, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			http.Error(w, "Error encoding comparison: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaJSON)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(formatDiff(diff)))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadResultRejectsBrokenGroups(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, err string
+	}{
+		{name: "valid", body: `{"schema_version":"1","matched_groups":[{"id":"G0001","members":[{"side":"credit","no":"C1"},{"side":"debit","no":"D1"}]}]}`},
+		{name: "no groups", body: `{"schema_version":"1","matched_groups":null}`},
+		{name: "empty members", body: `{"schema_version":"1","matched_groups":[{"id":"G0001","members":[]}]}`, err: "no members"},
+		{name: "null members", body: `{"schema_version":"1","matched_groups":[{"id":"G0001","members":null}]}`, err: "no members"},
+		{name: "missing members", body: `{"schema_version":"1","matched_groups":[{"id":"G0001"}]}`, err: "no members"},
+		{name: "bad side", body: `{"schema_version":"1","matched_groups":[{"id":"G0001","members":[{"no":"C1"}]}]}`, err: "side"},
+		{name: "schema", body: `{"schema_version":"0"}`, err: "schema version"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadResult(strings.NewReader(tc.body))
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("error %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDiffResultsPartlyBroken(t *testing.T) {
+	credit := func(no string, amount float64) resultTransaction {
+		return resultTransaction{Side: "credit", No: no, Date: "2024-01-05", Amount: amount}
+	}
+	debit := func(no string, amount float64) resultTransaction {
+		return resultTransaction{Side: "debit", No: no, Date: "2024-01-05", Amount: amount}
+	}
+
+	// D1 took C1 and C2 in the old run; in the new one C1 went to D2 and
+	// D1 and C2 are left over
+	oldResult := reconResult{
+		MatchedGroups:   []resultGroup{{ID: "G0001", Rule: ruleManyToOne, Members: []resultTransaction{debit("D1", 100), credit("C1", 60), credit("C2", 40)}}},
+		UnmatchedDebits: []resultTransaction{debit("D2", 60)},
+	}
+	newResult := reconResult{
+		MatchedGroups:    []resultGroup{{ID: "G0001", Rule: ruleOneToOne, Members: []resultTransaction{credit("C1", 60), debit("D2", 60)}}},
+		UnmatchedCredits: []resultTransaction{credit("C2", 40)},
+		UnmatchedDebits:  []resultTransaction{debit("D1", 100)},
+	}
+
+	diff := diffResults(oldResult, newResult)
+	if diff.Broken.Count != 0 {
+		t.Errorf("broken %d groups, want 0", diff.Broken.Count)
+	}
+	if diff.PartlyBroken.Count != 1 || diff.PartlyBroken.NetCredit != -40 || diff.PartlyBroken.NetDebit != -100 {
+		t.Errorf("partly broken %d groups, net %.2f/%.2f, want 1 group, net -40.00/-100.00", diff.PartlyBroken.Count, diff.PartlyBroken.NetCredit, diff.PartlyBroken.NetDebit)
+	}
+	if diff.Regrouped.Count != 1 || diff.NowUnmatched.Count != 2 || diff.NowMatched.Count != 1 {
+		t.Errorf("regrouped %d, now unmatched %d, now matched %d, want 1, 2 and 1", diff.Regrouped.Count, diff.NowUnmatched.Count, diff.NowMatched.Count)
+	}
+	if !strings.Contains(formatDiff(diff), "Partly broken groups") {
+		t.Errorf("text comparison has no partly broken groups:\n%s", formatDiff(diff))
+	}
+}
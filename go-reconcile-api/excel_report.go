@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Number formats of the Excel report
+const (
+	excelAmountFormat  = "#,##0.00"
+	excelDateFormat    = "yyyy-mm-dd"
+	excelPercentFormat = "0.00%"
+)
+
+// Styles shared by the sheets of the Excel report
+type excelStyles struct {
+	header  int
+	amount  int
+	date    int
+	percent int
+	total   int
+}
+
+// Write the reconciliation report as a workbook with Summary, Matched
+// Groups, Unmatched Credits, Unmatched Debits, Aging and Parameters sheets
+func writeExcelReport(w io.Writer, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	styles, err := newExcelStyles(f)
+	if err != nil {
+		return err
+	}
+
+	if err := f.SetSheetName("Sheet1", "Summary"); err != nil {
+		return err
+	}
+	summary := summarize(matchedTransactions, unmatchedCredits, unmatchedDebits)
+	if err := writeSummarySheet(f, styles, summary); err != nil {
+		return err
+	}
+	if err := writeMatchedSheet(f, styles, matchedTransactions); err != nil {
+		return err
+	}
+	if err := writeUnmatchedSheet(f, styles, "Unmatched Credits", convertToTransactions(unmatchedCredits)); err != nil {
+		return err
+	}
+	if err := writeUnmatchedSheet(f, styles, "Unmatched Debits", convertToTransactions(unmatchedDebits)); err != nil {
+		return err
+	}
+	if err := writeAgingSheet(f, styles, analyzeAging(params, unmatchedCredits, unmatchedDebits)); err != nil {
+		return err
+	}
+	if err := writeParametersSheet(f, styles, params); err != nil {
+		return err
+	}
+
+	return f.Write(w)
+}
+
+// Write the Excel report to a file for the -xlsx command-line option
+func writeExcelReportFile(filename string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeExcelReport(file, params, matchedTransactions, unmatchedCredits, unmatchedDebits)
+}
+
+// Create the styles of the Excel report in the workbook
+func newExcelStyles(f *excelize.File) (excelStyles, error) {
+	var styles excelStyles
+	var err error
+
+	amountFormat, dateFormat, percentFormat := excelAmountFormat, excelDateFormat, excelPercentFormat
+
+	if styles.header, err = f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"D9E1F2"}, Pattern: 1},
+	}); err != nil {
+		return styles, err
+	}
+	if styles.amount, err = f.NewStyle(&excelize.Style{CustomNumFmt: &amountFormat}); err != nil {
+		return styles, err
+	}
+	if styles.date, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat}); err != nil {
+		return styles, err
+	}
+	if styles.percent, err = f.NewStyle(&excelize.Style{CustomNumFmt: &percentFormat}); err != nil {
+		return styles, err
+	}
+	if styles.total, err = f.NewStyle(&excelize.Style{
+		Font:         &excelize.Font{Bold: true},
+		Border:       []excelize.Border{{Type: "top", Color: "000000", Style: 1}},
+		CustomNumFmt: &amountFormat,
+	}); err != nil {
+		return styles, err
+	}
+
+	return styles, nil
+}
+
+// Write a bold header row, freeze it and size the columns
+func writeHeader(f *excelize.File, sheet string, styles excelStyles, header []string, widths []float64) error {
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+	last, _ := excelize.CoordinatesToCellName(len(header), 1)
+	if err := f.SetCellStyle(sheet, "A1", last, styles.header); err != nil {
+		return err
+	}
+	for i, width := range widths {
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		if err := f.SetColWidth(sheet, col, col, width); err != nil {
+			return err
+		}
+	}
+	return f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+}
+
+// Add an autofilter over the header and data rows and a SUBTOTAL row below
+// them for each amount column, so the totals follow the filter
+func writeSubtotal(f *excelize.File, sheet string, styles excelStyles, columns int, lastRow int, amountCols ...int) error {
+	lastCell, _ := excelize.CoordinatesToCellName(columns, lastRow)
+	if err := f.AutoFilter(sheet, "A1:"+lastCell, nil); err != nil {
+		return err
+	}
+
+	totalRow := lastRow + 1
+	labelCell, _ := excelize.CoordinatesToCellName(1, totalRow)
+	if err := f.SetCellValue(sheet, labelCell, "Total"); err != nil {
+		return err
+	}
+
+	for _, amountCol := range amountCols {
+		colName, _ := excelize.ColumnNumberToName(amountCol)
+		totalCell := fmt.Sprintf("%s%d", colName, totalRow)
+		formula := fmt.Sprintf("SUBTOTAL(9,%s2:%s%d)", colName, colName, max(lastRow, 2))
+		if err := f.SetCellFormula(sheet, totalCell, formula); err != nil {
+			return err
+		}
+	}
+
+	endCell, _ := excelize.CoordinatesToCellName(columns, totalRow)
+	return f.SetCellStyle(sheet, labelCell, endCell, styles.total)
+}
+
+func writeSummarySheet(f *excelize.File, styles excelStyles, summary reconSummary) error {
+	sheet := "Summary"
+	if err := writeHeader(f, sheet, styles, []string{"", "Count", "Total"}, []float64{28, 12, 18}); err != nil {
+		return err
+	}
+
+	rows := []struct {
+		label string
+		count int
+		total interface{}
+	}{
+		{"Matched groups", summary.MatchedGroups, nil},
+		{"One-to-one groups", summary.OneToOneGroups, nil},
+		{"Many-to-one groups", summary.ManyToOneGroups, nil},
+		{"Groups with residual", summary.GroupsWithResidual, summary.ResidualTotal},
+		{"Matched credits", summary.MatchedCredits, summary.MatchedCreditTotal},
+		{"Matched debits", summary.MatchedDebits, summary.MatchedDebitTotal},
+		{"Unmatched credits", summary.UnmatchedCredits, summary.UnmatchedCreditTotal},
+		{"Unmatched debits", summary.UnmatchedDebits, summary.UnmatchedDebitTotal},
+	}
+	for i, row := range rows {
+		r := i + 2
+		values := []interface{}{row.label, row.count, row.total}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", r), &values); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheet, fmt.Sprintf("C%d", r), fmt.Sprintf("C%d", r), styles.amount); err != nil {
+			return err
+		}
+	}
+
+	r := len(rows) + 2
+	rates := []struct {
+		label string
+		rate  float64
+	}{
+		{"Credit match rate", summary.CreditMatchRate},
+		{"Debit match rate", summary.DebitMatchRate},
+	}
+	for i, rate := range rates {
+		values := []interface{}{rate.label, rate.rate}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", r+i), &values); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheet, fmt.Sprintf("B%d", r+i), fmt.Sprintf("B%d", r+i), styles.percent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeMatchedSheet(f *excelize.File, styles excelStyles, matchedTransactions [][]Transaction) error {
+	sheet := "Matched Groups"
+	if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	// Credits and debits have a column each, so each side gets its own total
+	header := []string{"Group ID", "Rule", "Side", "Transaction No", "Date", "Credit Amount", "Debit Amount", "Group Residual"}
+	if err := writeHeader(f, sheet, styles, header, []float64{10, 13, 8, 18, 12, 16, 16, 16}); err != nil {
+		return err
+	}
+
+	r := 1
+	for i, transactions := range matchedTransactions {
+		groupID, rule, residual := matchGroupID(i), matchRule(transactions), groupResidual(transactions)
+		for j, side := range groupSides(transactions) {
+			r++
+			values := []interface{}{groupID, rule, side, transactions[j].No, transactions[j].Date, nil, nil, residual}
+			if side == "credit" {
+				values[5] = transactions[j].Value
+			} else {
+				values[6] = transactions[j].Value
+			}
+			if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", r), &values); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r > 1 {
+		if err := f.SetCellStyle(sheet, "E2", fmt.Sprintf("E%d", r), styles.date); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheet, "F2", fmt.Sprintf("H%d", r), styles.amount); err != nil {
+			return err
+		}
+	}
+
+	return writeSubtotal(f, sheet, styles, len(header), r, 6, 7)
+}
+
+func writeUnmatchedSheet(f *excelize.File, styles excelStyles, sheet string, transactions []Transaction) error {
+	if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	header := []string{"Transaction No", "Date", "Amount", "Source"}
+	if err := writeHeader(f, sheet, styles, header, []float64{18, 12, 16, 14}); err != nil {
+		return err
+	}
+
+	for i, transaction := range transactions {
+		values := []interface{}{transaction.No, transaction.Date, transaction.Value, transaction.Source}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &values); err != nil {
+			return err
+		}
+	}
+
+	r := len(transactions) + 1
+	if r > 1 {
+		if err := f.SetCellStyle(sheet, "B2", fmt.Sprintf("B%d", r), styles.date); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheet, "C2", fmt.Sprintf("C%d", r), styles.amount); err != nil {
+			return err
+		}
+	}
+
+	return writeSubtotal(f, sheet, styles, len(header), r, 3)
+}
+
+func writeAgingSheet(f *excelize.File, styles excelStyles, analysis agingAnalysis) error {
+	sheet := "Aging"
+	if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	header := []string{"Days", "Credits", "Credit Total", "Debits", "Debit Total"}
+	if err := writeHeader(f, sheet, styles, header, []float64{14, 10, 16, 10, 16}); err != nil {
+		return err
+	}
+
+	for i, bucket := range analysis.Buckets {
+		values := []interface{}{bucket.Label, bucket.CreditCount, bucket.CreditTotal, bucket.DebitCount, bucket.DebitTotal}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &values); err != nil {
+			return err
+		}
+	}
+
+	last := len(analysis.Buckets) + 1
+	total := last + 1
+	if err := f.SetCellValue(sheet, fmt.Sprintf("A%d", total), "Total"); err != nil {
+		return err
+	}
+	for _, col := range []string{"B", "C", "D", "E"} {
+		if err := f.SetCellFormula(sheet, fmt.Sprintf("%s%d", col, total), fmt.Sprintf("SUM(%s2:%s%d)", col, col, last)); err != nil {
+			return err
+		}
+	}
+	if err := f.SetCellStyle(sheet, "C2", fmt.Sprintf("C%d", last), styles.amount); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheet, "E2", fmt.Sprintf("E%d", last), styles.amount); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheet, fmt.Sprintf("A%d", total), fmt.Sprintf("E%d", total), styles.total); err != nil {
+		return err
+	}
+
+	return f.SetCellValue(sheet, fmt.Sprintf("A%d", total+2), "As of "+analysis.AsOf)
+}
+
+func writeParametersSheet(f *excelize.File, styles excelStyles, params runParameters) error {
+	sheet := "Parameters"
+	if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	if err := writeHeader(f, sheet, styles, []string{"Parameter", "Value"}, []float64{28, 68}); err != nil {
+		return err
+	}
+
+	rows := [][]interface{}{
+		{"Days", params.Days},
+		{"Threshold", params.Threshold},
+		{"Run at", params.RunAt.Format("2006-01-02 15:04:05 MST")},
+	}
+	if params.AsOf != "" {
+		rows = append(rows, []interface{}{"Aging as of", params.AsOf})
+	}
+	if len(params.AgingBuckets) > 0 {
+		rows = append(rows, []interface{}{"Aging buckets", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(params.AgingBuckets)), ","), "[]")})
+	}
+	for _, input := range params.Inputs {
+		rows = append(rows, []interface{}{input.Name + " SHA-256", input.SHA256})
+	}
+	if balances := params.Statement; balances != nil {
+		rows = append(rows,
+			[]interface{}{"Book side", balances.BookSide},
+			[]interface{}{"Book opening balance", balances.BookOpening},
+			[]interface{}{"Book closing balance", balances.BookClosing},
+			[]interface{}{"Bank opening balance", balances.BankOpening},
+			[]interface{}{"Bank closing balance", balances.BankClosing},
+		)
+	}
+	for i, row := range rows {
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
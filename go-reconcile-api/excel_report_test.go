@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExcelMatchedSheetTotalsEachSide(t *testing.T) {
+	day := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	matched := [][]Transaction{
+		{{No: "C1", Value: 100, Date: day}, {No: "D1", Value: 100, Date: day}},
+		{{No: "D2", Value: 300, Date: day}, {No: "C2", Value: 120, Date: day}, {No: "C3", Value: 175, Date: day}},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeExcelReport(buf, runParameters{Days: 7, Threshold: 10, RunAt: day}, matched, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sheet := "Matched Groups"
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]string{
+		{"G0001", "one-to-one", "credit", "C1", "", "100", "", "0"},
+		{"G0001", "one-to-one", "debit", "D1", "", "", "100", "0"},
+		{"G0002", "many-to-one", "debit", "D2", "", "", "300", "5"},
+		{"G0002", "many-to-one", "credit", "C2", "", "120", "", "5"},
+		{"G0002", "many-to-one", "credit", "C3", "", "175", "", "5"},
+	}
+	for i, want := range wantRows {
+		got := rows[i+1]
+		for j, cell := range want {
+			if j == 4 {
+				continue
+			}
+			value := ""
+			if j < len(got) {
+				value = got[j]
+			}
+			if value != cell {
+				t.Errorf("row %d column %d = %q, want %q", i+2, j+1, value, cell)
+			}
+		}
+	}
+
+	for cell, want := range map[string]string{
+		"F7": "SUBTOTAL(9,F2:F6)",
+		"G7": "SUBTOTAL(9,G2:G6)",
+		"H7": "",
+	} {
+		formula, err := f.GetCellFormula(sheet, cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formula != want {
+			t.Errorf("%s formula %q, want %q", cell, formula, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Formats of the match export
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+)
+
+// Date format of the match export
+const exportDateLayout = "2006-01-02"
+
+// One transaction of the match export. Matched and unmatched files share
+// this schema; unmatched rows have no group ID, rule or confidence.
+type exportRow struct {
+	GroupID       string  `json:"group_id"`
+	Side          string  `json:"side"`
+	TransactionNo string  `json:"transaction_no"`
+	Date          string  `json:"date"`
+	Amount        float64 `json:"amount"`
+	GroupResidual float64 `json:"group_residual"`
+	MatchRule     string  `json:"match_rule"`
+	Confidence    float64 `json:"confidence"`
+}
+
+// Column names of the CSV export, in exportRow order
+var exportHeader = []string{"Group ID", "Side", "Transaction No", "Date", "Amount", "Group Residual", "Match Rule", "Confidence"}
+
+// File of the match export and its rows
+type exportFile struct {
+	Name string
+	Rows []exportRow
+}
+
+// Confidence of a matched group between 0 and 1. An exact amount on the same
+// day scores 1. The residual costs up to half of the score as it approaches
+// the threshold, the widest date gap in the group up to half as it
+// approaches the window, and many-to-one groups lose a further tenth.
+func matchConfidence(transactions []Transaction, days int, threshold float64) float64 {
+	amountScore := 1.0
+	if residual := math.Abs(groupResidual(transactions)); residual > 0 {
+		amountScore = 0.5
+		if threshold > 0 && residual < threshold {
+			amountScore = 1 - 0.5*residual/threshold
+		}
+	}
+
+	gap := groupDateGap(transactions)
+	dateScore := 1.0
+	if gap > 0 {
+		dateScore = 0.5
+		if days > 0 && gap < days {
+			dateScore = 1 - 0.5*float64(gap)/float64(days)
+		}
+	}
+
+	confidence := amountScore * dateScore
+	if matchRule(transactions) == ruleManyToOne {
+		confidence *= 0.9
+	}
+	return math.Round(confidence*100) / 100
+}
+
+// Export rows of the matched groups, one per transaction
+func matchedExportRows(matchedTransactions [][]Transaction, params runParameters) []exportRow {
+	var rows []exportRow
+	for i, transactions := range matchedTransactions {
+		groupID := matchGroupID(i)
+		residual := groupResidual(transactions)
+		rule := matchRule(transactions)
+		confidence := matchConfidence(transactions, params.Days, params.Threshold)
+
+		for j, side := range groupSides(transactions) {
+			rows = append(rows, exportRow{
+				GroupID:       groupID,
+				Side:          side,
+				TransactionNo: transactions[j].No,
+				Date:          transactions[j].Date.Format(exportDateLayout),
+				Amount:        transactions[j].Value,
+				GroupResidual: residual,
+				MatchRule:     rule,
+				Confidence:    confidence,
+			})
+		}
+	}
+	return rows
+}
+
+// Export rows of the unmatched transactions of one side
+func unmatchedExportRows(transactions []Transaction, side string) []exportRow {
+	rows := make([]exportRow, len(transactions))
+	for i, transaction := range transactions {
+		rows[i] = exportRow{
+			Side:          side,
+			TransactionNo: transaction.No,
+			Date:          transaction.Date.Format(exportDateLayout),
+			Amount:        transaction.Value,
+		}
+	}
+	return rows
+}
+
+// The matched, unmatched credit and unmatched debit files of a run
+func exportFiles(format string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) []exportFile {
+	return []exportFile{
+		{"matched_transactions." + format, matchedExportRows(matchedTransactions, params)},
+		{"unmatched_credits." + format, unmatchedExportRows(convertToTransactions(unmatchedCredits), "credit")},
+		{"unmatched_debits." + format, unmatchedExportRows(convertToTransactions(unmatchedDebits), "debit")},
+	}
+}
+
+// Write export rows as CSV or JSON
+func writeExport(w io.Writer, format string, rows []exportRow) error {
+	switch format {
+	case exportCSV:
+		return writeExportCSV(w, rows)
+	case exportJSON:
+		if rows == nil {
+			rows = []exportRow{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// Write export rows as CSV with a header row
+func writeExportCSV(w io.Writer, rows []exportRow) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(exportHeader); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := []string{
+			row.GroupID,
+			row.Side,
+			row.TransactionNo,
+			row.Date,
+			fmt.Sprintf("%.2f", row.Amount),
+			"",
+			row.MatchRule,
+			"",
+		}
+		if row.GroupID != "" {
+			record[5] = fmt.Sprintf("%.2f", row.GroupResidual)
+			record[7] = strconv.FormatFloat(row.Confidence, 'f', 2, 64)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Write the export files of a run into the current directory
+func writeExportFiles(format string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	for _, export := range exportFiles(format, params, matchedTransactions, unmatchedCredits, unmatchedDebits) {
+		file, err := os.Create(export.Name)
+		if err != nil {
+			return err
+		}
+		err = writeExport(file, format, export.Rows)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", export.Name, err)
+		}
+	}
+	return nil
+}
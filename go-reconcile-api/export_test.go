@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportFiles(t *testing.T) {
+	params := runParameters{Days: 7, Threshold: 10}
+	matched := [][]Transaction{
+		{jan("C1", 5, 100), jan("D1", 5, 100)},
+		{jan("D2", 9, 300), jan("C2", 7, 120), jan("C3", 8, 175)},
+	}
+	unmatchedCredits := []CreditTransaction{{Transaction: jan("C9", 3, 40.5)}}
+
+	for _, tc := range []struct {
+		format string
+		want   map[string]string
+	}{
+		{
+			format: exportCSV,
+			want: map[string]string{
+				"matched_transactions.csv": `Group ID,Side,Transaction No,Date,Amount,Group Residual,Match Rule,Confidence
+G0001,credit,C1,2024-01-05,100.00,0.00,one-to-one,1.00
+G0001,debit,D1,2024-01-05,100.00,0.00,one-to-one,1.00
+G0002,debit,D2,2024-01-09,300.00,5.00,many-to-one,0.58
+G0002,credit,C2,2024-01-07,120.00,5.00,many-to-one,0.58
+G0002,credit,C3,2024-01-08,175.00,5.00,many-to-one,0.58
+`,
+				"unmatched_credits.csv": `Group ID,Side,Transaction No,Date,Amount,Group Residual,Match Rule,Confidence
+,credit,C9,2024-01-03,40.50,,,
+`,
+				"unmatched_debits.csv": "Group ID,Side,Transaction No,Date,Amount,Group Residual,Match Rule,Confidence\n",
+			},
+		},
+		{
+			format: exportJSON,
+			want: map[string]string{
+				"matched_transactions.json": `[{"group_id":"G0001","side":"credit","transaction_no":"C1","date":"2024-01-05","amount":100,"group_residual":0,"match_rule":"one-to-one","confidence":1},` +
+					`{"group_id":"G0001","side":"debit","transaction_no":"D1","date":"2024-01-05","amount":100,"group_residual":0,"match_rule":"one-to-one","confidence":1},` +
+					`{"group_id":"G0002","side":"debit","transaction_no":"D2","date":"2024-01-09","amount":300,"group_residual":5,"match_rule":"many-to-one","confidence":0.58},` +
+					`{"group_id":"G0002","side":"credit","transaction_no":"C2","date":"2024-01-07","amount":120,"group_residual":5,"match_rule":"many-to-one","confidence":0.58},` +
+					`{"group_id":"G0002","side":"credit","transaction_no":"C3","date":"2024-01-08","amount":175,"group_residual":5,"match_rule":"many-to-one","confidence":0.58}]`,
+				"unmatched_credits.json": `[{"group_id":"","side":"credit","transaction_no":"C9","date":"2024-01-03","amount":40.5,"group_residual":0,"match_rule":"","confidence":0}]`,
+				"unmatched_debits.json":  `[]`,
+			},
+		},
+	} {
+		files := exportFiles(tc.format, params, matched, unmatchedCredits, nil)
+		if len(files) != len(tc.want) {
+			t.Fatalf("%s: %d files, want %d", tc.format, len(files), len(tc.want))
+		}
+		for _, file := range files {
+			want, ok := tc.want[file.Name]
+			if !ok {
+				t.Errorf("%s: unexpected file %s", tc.format, file.Name)
+				continue
+			}
+			var b bytes.Buffer
+			if err := writeExport(&b, tc.format, file.Rows); err != nil {
+				t.Fatalf("%s: %v", file.Name, err)
+			}
+			got := b.String()
+			if tc.format == exportJSON {
+				// Compare without the indentation
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, b.Bytes()); err != nil {
+					t.Fatalf("%s: %v", file.Name, err)
+				}
+				got = compact.String()
+			}
+			if got != want {
+				t.Errorf("%s:\n%s\nwant\n%s", file.Name, got, want)
+			}
+		}
+	}
+
+	if err := writeExport(&bytes.Buffer{}, "xml", nil); err == nil || !strings.Contains(err.Error(), "unknown export format") {
+		t.Errorf("xml export: error %v, want an unknown format", err)
+	}
+}
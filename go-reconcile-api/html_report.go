@@ -0,0 +1,169 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Template of the HTML report. It carries its own CSS and JavaScript so the
+// report opens offline as a single file.
+//
+//go:embed report_template.html
+var reportTemplateHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"money":     formatMoney,
+	"percent":   formatPercent,
+	"rateClass": rateClass,
+	"idFor": func(title string) string {
+		return strings.ToLower(strings.ReplaceAll(title, " ", "-"))
+	},
+}).Parse(reportTemplateHTML))
+
+// Buckets of the date gap histogram, by largest gap in days
+var dateGapBuckets = []struct {
+	label string
+	max   int
+}{
+	{"Same day", 0},
+	{"1-3 days", 3},
+	{"4-7 days", 7},
+	{"8-14 days", 14},
+	{"15-30 days", 30},
+	{"31-60 days", 60},
+	{"Over 60 days", math.MaxInt},
+}
+
+// Data of the HTML report template
+type htmlReport struct {
+	Result    reconResult
+	RunAt     string
+	Groups    []htmlGroup
+	Histogram []histogramBar
+	Unmatched map[string][]resultTransaction
+	Sweep     *sweepResult
+	Chart     sweepChart
+}
+
+// Matched group of the HTML report with its debit, credits and date gap
+type htmlGroup struct {
+	resultGroup
+	Debit   resultTransaction
+	Credits []resultTransaction
+	Gap     int
+}
+
+// Bar of the date gap histogram. Width is a percentage of the longest bar.
+type histogramBar struct {
+	Label string
+	Count int
+	Width float64
+}
+
+// Write the reconciliation report as a self-contained HTML page, with the
+// parameter sweep when one was run
+func writeHTMLReport(w io.Writer, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, rejected []rejectedRow, sweep *sweepResult) error {
+	result := buildResult(params, matchedTransactions, unmatchedCredits, unmatchedDebits, rejected)
+	result.Sweep = sweep
+
+	report := htmlReport{
+		Result: result,
+		RunAt:  params.RunAt.Format("2006-01-02 15:04:05 MST"),
+		Unmatched: map[string][]resultTransaction{
+			"Unmatched credits": result.UnmatchedCredits,
+			"Unmatched debits":  result.UnmatchedDebits,
+		},
+		Sweep: sweep,
+	}
+	if sweep != nil {
+		report.Chart = newSweepChart(*sweep)
+	}
+
+	counts := make([]int, len(dateGapBuckets))
+	for i, group := range result.MatchedGroups {
+		htmlGroup := htmlGroup{resultGroup: group, Gap: groupDateGap(matchedTransactions[i])}
+		for _, member := range group.Members {
+			if member.Side == "debit" {
+				htmlGroup.Debit = member
+			} else {
+				htmlGroup.Credits = append(htmlGroup.Credits, member)
+			}
+		}
+		report.Groups = append(report.Groups, htmlGroup)
+
+		for j, bucket := range dateGapBuckets {
+			if htmlGroup.Gap <= bucket.max {
+				counts[j]++
+				break
+			}
+		}
+	}
+
+	longest := 0
+	for _, count := range counts {
+		longest = max(longest, count)
+	}
+	for i, bucket := range dateGapBuckets {
+		bar := histogramBar{Label: bucket.label, Count: counts[i]}
+		if longest > 0 {
+			bar.Width = math.Round(float64(counts[i]) / float64(longest) * 80)
+		}
+		report.Histogram = append(report.Histogram, bar)
+	}
+
+	return reportTemplate.Execute(w, report)
+}
+
+// Write the HTML report to a file for the -html command-line option
+func writeHTMLReportFile(filename string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, sweep *sweepResult) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeHTMLReport(file, params, matchedTransactions, unmatchedCredits, unmatchedDebits, nil, sweep)
+}
+
+// Format an amount with thousands separators and two decimals
+func formatMoney(amount float64) string {
+	s := strconv.FormatFloat(math.Abs(amount), 'f', 2, 64)
+	whole, cents, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if amount < 0 && s != "0.00" {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteByte('.')
+	b.WriteString(cents)
+	return b.String()
+}
+
+// Format a rate between 0 and 1 as a percentage
+func formatPercent(rate float64) string {
+	return fmt.Sprintf("%.1f%%", rate*100)
+}
+
+// CSS class of a match rate card
+func rateClass(rate float64) string {
+	switch {
+	case rate >= 0.95:
+		return "good"
+	case rate >= 0.8:
+		return "warn"
+	default:
+		return "bad"
+	}
+}
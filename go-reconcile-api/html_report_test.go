@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTMLReportEscapesText(t *testing.T) {
+	credit := jan(`<script>alert("no")</script>`, 5, 100)
+	debit := jan("D1", 5, 100)
+	unmatched := jan("C9", 6, 40)
+	unmatched.Description = `Fish & Chips <img src=x onerror=alert(1)>`
+	unmatched.Source = `Sheet1!"7"`
+	params := runParameters{Days: 7, RunAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Inputs: []inputFile{{Name: "<b>credits</b>.csv"}}}
+
+	var b bytes.Buffer
+	if err := writeHTMLReport(&b, params, [][]Transaction{{credit, debit}}, []CreditTransaction{{Transaction: unmatched}}, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	html := b.String()
+
+	for _, raw := range []string{"<script>alert", "<img src=x", "<b>credits</b>", `Sheet1!"7"`} {
+		if strings.Contains(html, raw) {
+			t.Errorf("report holds %q unescaped", raw)
+		}
+	}
+	for _, escaped := range []string{
+		"&lt;script&gt;alert(&#34;no&#34;)&lt;/script&gt;",
+		"Fish &amp; Chips &lt;img src=x onerror=alert(1)&gt;",
+		"&lt;b&gt;credits&lt;/b&gt;.csv",
+		"Sheet1!&#34;7&#34;",
+	} {
+		if !strings.Contains(html, escaped) {
+			t.Errorf("report has no %q", escaped)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/gin-gonic/gin/ingest"
+)
+
+// Transactions of a document for one side. Entries that belong to a side,
+// as those of bank statements, journals and workbooks do, are taken from
+// that side as positive values; CSV rows are taken as they are. Signed takes
+// every entry with its amount as is instead, for statement mode.
+func documentTransactions(document ingest.Document, side string, signed bool) []Transaction {
+	var transactions []Transaction
+	for _, entry := range document.Entries {
+		value := entry.Amount
+		if entry.Side != "" && !signed {
+			if entry.Side != side {
+				continue
+			}
+			value = math.Abs(value)
+		}
+		transactions = append(transactions, Transaction{
+			No:          entry.Reference,
+			Value:       value,
+			Date:        entry.Date,
+			Source:      entry.Source,
+			Description: entry.Description,
+		})
+	}
+	return transactions
+}
+
+// Options of reading one side of a run: those of the parsers, plus Signed
+// to keep the signs of bank statement and journal amounts, for statement
+// mode
+type inputOptions struct {
+	ingest.Options
+	Signed bool
+}
+
+// Transactions of one side of a run with the rows that had to be skipped and
+// the bank statement or journal they were read from, nil for other formats.
+// OtherSide lists the entries of a bank statement, journal or workbook that
+// belong to the other side and were left out; reconciling both sides of such
+// a file takes -w. Document is the file as parsed, before it was split by
+// side.
+type sideInput struct {
+	Transactions []Transaction
+	Rejected     []rejectedRow
+	OtherSide    []rejectedRow
+	Statement    *ingest.Document
+	Journal      *ingest.Document
+	Document     ingest.Document
+}
+
+// Read one side of a run from an uploaded file in any of the formats of the
+// ingest package
+func parseSideInput(name string, data []byte, side string, options inputOptions) (sideInput, error) {
+	var input sideInput
+
+	document, err := ingest.Parse(name, data, options.Options)
+	if err != nil {
+		return input, err
+	}
+
+	input.Document = document
+	input.Transactions = documentTransactions(document, side, options.Signed)
+	for _, row := range document.Rejected {
+		input.Rejected = append(input.Rejected, rejectedRow{Side: side, Line: row.Line, Record: row.Record, Reason: row.Reason})
+	}
+	if !options.Signed {
+		for _, entry := range document.Entries {
+			if entry.Side == "" || entry.Side == side {
+				continue
+			}
+			input.OtherSide = append(input.OtherSide, rejectedRow{
+				Side:   side,
+				Record: []string{entry.Source, entry.Reference, entry.Date.Format(exportDateLayout), fmt.Sprintf("%.2f", entry.Amount)},
+				Reason: fmt.Sprintf("%s entry of a file given as the %s side", entry.Side, side),
+			})
+		}
+	}
+	switch document.Kind {
+	case ingest.KindStatement:
+		input.Statement = &document
+	case ingest.KindJournal:
+		input.Journal = &document
+	}
+	return input, nil
+}
+
+// Read one side of a run from disk for the -c and -d command-line options,
+// like parseSideInput. Skipped rows and left out entries are logged.
+func readSideFile(filePath string, side string, options inputOptions) (sideInput, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return sideInput{}, err
+	}
+	input, err := parseSideInput(filePath, data, side, options)
+	for _, row := range input.Rejected {
+		log.Printf("Error parsing %s transaction on line %d: %s", row.Side, row.Line, row.Reason)
+	}
+	if len(input.OtherSide) > 0 {
+		log.Printf("Warning: left out %d entries of %s that belong to the other side; give the file as -w to reconcile both of its sides", len(input.OtherSide), filePath)
+	}
+	return input, err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSideInputListsOtherSide(t *testing.T) {
+	statement := []byte(`<OFX><BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>250.00<FITID>F1</STMTTRN>
+<STMTTRN><DTPOSTED>20240106<TRNAMT>-75.50<FITID>F2</STMTTRN>
+<STMTTRN><DTPOSTED>20240107<TRNAMT>-10.00<FITID>F3</STMTTRN>
+</BANKTRANLIST></OFX>`)
+
+	for _, tc := range []struct {
+		side         string
+		signed       bool
+		transactions []string
+		otherSide    []string
+	}{
+		{side: "credit", transactions: []string{"F1"}, otherSide: []string{"F2", "F3"}},
+		{side: "debit", transactions: []string{"F2", "F3"}, otherSide: []string{"F1"}},
+		{side: "credit", signed: true, transactions: []string{"F1", "F2", "F3"}},
+	} {
+		input, err := parseSideInput("stmt.ofx", statement, tc.side, inputOptions{Signed: tc.signed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var transactions, otherSide []string
+		for _, transaction := range input.Transactions {
+			transactions = append(transactions, transaction.No)
+			if transaction.Value < 0 && !tc.signed {
+				t.Errorf("%s side: %s has value %.2f", tc.side, transaction.No, transaction.Value)
+			}
+		}
+		for _, row := range input.OtherSide {
+			otherSide = append(otherSide, row.Record[1])
+			if row.Side != tc.side || row.Reason == "" {
+				t.Errorf("%s side: left out entry %+v", tc.side, row)
+			}
+		}
+		if len(input.Rejected) != 0 {
+			t.Errorf("%s side: rejected %v", tc.side, input.Rejected)
+		}
+		if strings.Join(transactions, ",") != strings.Join(tc.transactions, ",") || strings.Join(otherSide, ",") != strings.Join(tc.otherSide, ",") {
+			t.Errorf("%s side (signed %v): read %v and left out %v, want %v and %v", tc.side, tc.signed, transactions, otherSide, tc.transactions, tc.otherSide)
+		}
+	}
+}
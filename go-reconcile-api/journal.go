@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/ingest"
+)
+
+// Default account of the adjusting entries for -journal-out
+const defaultWriteOffAccount = "Expenses:Reconciliation:WriteOff"
+
+// Adjusting entry of a matched group whose sides don't agree, posted to the
+// reconciled account and offset to the write-off account
+type journalAdjustment struct {
+	GroupID string
+	Index   int // Index of the group in the matched transactions
+	Date    time.Time
+	Amount  float64
+}
+
+// Adjustments that clear the residuals of the many-to-one groups; one-to-one
+// groups match exactly. In statement mode the book side takes the
+// difference to the bank side; otherwise the account's debits and credits
+// are netted, debits less credits, and the net is reversed.
+func journalAdjustments(params runParameters, matchedTransactions [][]Transaction) []journalAdjustment {
+	var adjustments []journalAdjustment
+	for i, transactions := range matchedTransactions {
+		if matchRule(transactions) != ruleManyToOne {
+			continue
+		}
+		var amount float64
+		if params.Statement != nil {
+			for j, side := range groupSides(transactions) {
+				if side == params.Statement.BookSide {
+					amount -= transactions[j].Value
+				} else {
+					amount += transactions[j].Value
+				}
+			}
+		} else {
+			amount = -groupResidual(transactions)
+		}
+		if amount = roundCents(amount); amount == 0 {
+			continue
+		}
+
+		date := transactions[0].Date
+		for _, transaction := range transactions[1:] {
+			if transaction.Date.After(date) {
+				date = transaction.Date
+			}
+		}
+		adjustments = append(adjustments, journalAdjustment{GroupID: matchGroupID(i), Index: i, Date: date, Amount: amount})
+	}
+	sort.SliceStable(adjustments, func(i, j int) bool {
+		return adjustments[i].Date.Before(adjustments[j].Date)
+	})
+	return adjustments
+}
+
+// Write the adjustments as journal entries in the given syntax
+func writeJournalAdjustments(w io.Writer, syntax, account, writeOffAccount, commodity string, adjustments []journalAdjustment) error {
+	var b bytes.Buffer
+	amount := func(value float64) string {
+		s := strconv.FormatFloat(value, 'f', 2, 64)
+		if commodity != "" {
+			s += " " + commodity
+		}
+		return s
+	}
+	width := max(len(account), len(writeOffAccount)) + 4
+
+	for _, adjustment := range adjustments {
+		if syntax == ingest.SyntaxBeancount {
+			fmt.Fprintf(&b, "%s * \"Reconciliation\" \"Adjustment of %s\"\n", adjustment.Date.Format("2006-01-02"), adjustment.GroupID)
+			fmt.Fprintf(&b, "  recon-group: %q\n", adjustment.GroupID)
+		} else {
+			fmt.Fprintf(&b, "%s * (%s) Reconciliation adjustment\n", adjustment.Date.Format("2006/01/02"), adjustment.GroupID)
+		}
+		fmt.Fprintf(&b, "  %-*s %s\n", width, account, amount(adjustment.Amount))
+		fmt.Fprintf(&b, "  %-*s %s\n\n", width, writeOffAccount, amount(-adjustment.Amount))
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Write the adjustments of a run to a file for the -journal-out option, in
+// the syntax and commodity of the journal input, if there's one, or else in
+// the syntax the file's extension names. The entries are meant to be
+// appended to the journal that was reconciled, so they post to its account
+// and read back through the ingest package. -adjustments-out writes the same
+// residuals, with write-offs of unmatched items, for import into a general
+// ledger instead; see writeAdjustments.
+func writeJournalFile(filename, account, writeOffAccount string, params runParameters, matchedTransactions [][]Transaction, journals ...*ingest.Document) error {
+	if account == "" {
+		return fmt.Errorf("-journal-out needs -account")
+	}
+
+	syntax, commodity := ingest.SyntaxLedger, ""
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".beancount", ".bean":
+		syntax = ingest.SyntaxBeancount
+	}
+	for _, j := range journals {
+		if j != nil {
+			syntax, commodity = j.Format, j.Currency
+			break
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeJournalAdjustments(file, syntax, account, writeOffAccount, commodity, journalAdjustments(params, matchedTransactions))
+}
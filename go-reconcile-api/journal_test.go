@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/gin-gonic/gin/ingest"
+)
+
+func TestWriteJournalAdjustmentsReadsBack(t *testing.T) {
+	matched := [][]Transaction{
+		{jan("C1", 5, 100), jan("D1", 5, 100)},
+		{jan("D2", 9, 300), jan("C2", 7, 120), jan("C3", 8, 175)},
+	}
+	adjustments := journalAdjustments(runParameters{}, matched)
+	if len(adjustments) != 1 || adjustments[0].GroupID != "G0002" || adjustments[0].Amount != -5 {
+		t.Fatalf("adjustments %+v, want G0002 of -5.00", adjustments)
+	}
+
+	for _, tc := range []struct {
+		syntax, file string
+	}{
+		{ingest.SyntaxBeancount, "adjustments.beancount"},
+		{ingest.SyntaxLedger, "adjustments.ledger"},
+	} {
+		buf := new(bytes.Buffer)
+		if err := writeJournalAdjustments(buf, tc.syntax, "Assets:Bank", defaultWriteOffAccount, "USD", adjustments); err != nil {
+			t.Fatal(err)
+		}
+		document, err := ingest.Parse(tc.file, buf.Bytes(), ingest.Options{Account: "Assets:Bank"})
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", tc.syntax, err, buf)
+		}
+		if len(document.Entries) != 1 || document.Format != tc.syntax {
+			t.Fatalf("%s: read %d entries as %s\n%s", tc.syntax, len(document.Entries), document.Format, buf)
+		}
+		entry := document.Entries[0]
+		if got := fmt.Sprintf("%s %s %.2f", entry.Date.Format(exportDateLayout), document.Currency, entry.Amount); got != "2024-01-09 USD -5.00" {
+			t.Errorf("%s: entry %s, want 2024-01-09 USD -5.00\n%s", tc.syntax, got, buf)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layout of the period labels of the open-items store
+const periodLayout = "2006-01"
+
+// File-based store of the items runs left unmatched. Open items join the
+// input of the next run and are closed, with the period they cleared in, once
+// they match. The store is a JSON file holding every item it has seen.
+type openItemStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Item of the open-items store. ID is the lineage ID that follows the
+// transaction from run to run, see lineageID. ClosedPeriod is empty while
+// the item is open.
+type openItem struct {
+	ID           string  `json:"id"`
+	Side         string  `json:"side"`
+	No           string  `json:"no"`
+	Date         string  `json:"date"`
+	Amount       float64 `json:"amount"`
+	Source       string  `json:"source,omitempty"`
+	OpenedPeriod string  `json:"opened_period"`
+	ClosedPeriod string  `json:"closed_period,omitempty"`
+}
+
+// Open item with its age in days on the listing date
+type agedOpenItem struct {
+	openItem
+	AgeDays int `json:"age_days"`
+}
+
+// Store configured with -store, nil without it
+var openItems *openItemStore
+
+// Lineage ID of a transaction: its side, number, date and amount, which stay
+// the same however many periods it's carried. Identical transactions share
+// it; see lineageIDs for how they're told apart.
+func lineageID(side string, transaction Transaction) string {
+	return fmt.Sprintf("%s:%s:%s:%.2f", side, transaction.No, transaction.Date.Format(exportDateLayout), transaction.Value)
+}
+
+// Lineage IDs of the transactions of one side of an input. The second and
+// later of identical transactions get their occurrence appended, #2, #3 and
+// so on, so each keeps a lineage of its own.
+func lineageIDs(side string, transactions []Transaction) []string {
+	ids := make([]string, len(transactions))
+	occurrences := make(map[string]int)
+	for i, transaction := range transactions {
+		id := lineageID(side, transaction)
+		occurrences[id]++
+		if n := occurrences[id]; n > 1 {
+			id = fmt.Sprintf("%s#%d", id, n)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// Check the period label of a run, YYYY-MM, and default it to the month of
+// runAt
+func parsePeriod(period string, runAt time.Time) (string, error) {
+	if period == "" {
+		return runAt.Format(periodLayout), nil
+	}
+	if _, err := time.Parse(periodLayout, period); err != nil {
+		return "", fmt.Errorf("expected YYYY-MM, got %q", period)
+	}
+	return period, nil
+}
+
+func newOpenItemStore(path string) *openItemStore {
+	return &openItemStore{path: path}
+}
+
+// Read the items of the store. A store that doesn't exist yet is empty.
+func (s *openItemStore) load() ([]openItem, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []openItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("reading open items from %s: %w", s.path, err)
+	}
+	return items, nil
+}
+
+// Replace the items of the store. The file is written next to the store and
+// renamed over it, so a failed write leaves the previous store intact.
+func (s *openItemStore) save(items []openItem) error {
+	if items == nil {
+		items = []openItem{}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Reconcile with the open items of earlier runs added to the input, then
+// close the items that matched and open the ones left over, in period. The
+// decisions go to trace when it isn't nil.
+func (s *openItemStore) reconcile(period string, credits []Transaction, debits []Transaction, days int, threshold float64, trace *decisionTrace) ([][]Transaction, []CreditTransaction, []DebitTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.load()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	index := make(map[string]int, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+	}
+
+	inputs := []struct {
+		side         string
+		transactions []Transaction
+		ids          []string
+	}{{side: "credit", transactions: credits}, {side: "debit", transactions: debits}}
+	present := make(map[string]bool)
+	for i := range inputs {
+		inputs[i].ids = lineageIDs(inputs[i].side, inputs[i].transactions)
+		for _, id := range inputs[i].ids {
+			present[id] = true
+		}
+	}
+
+	// The lineages of the run by lineageID, the open items of earlier runs
+	// first so identical transactions close oldest first. Items still pasted
+	// into the new files by hand aren't added twice.
+	lineages := make(map[string][]string)
+	for _, item := range items {
+		if item.ClosedPeriod != "" {
+			continue
+		}
+		date, err := time.Parse(exportDateLayout, item.Date)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open item %s: %w", item.ID, err)
+		}
+		transaction := Transaction{No: item.No, Value: item.Amount, Date: date, Source: item.Source}
+		key := lineageID(item.Side, transaction)
+		lineages[key] = append(lineages[key], item.ID)
+		if present[item.ID] {
+			continue
+		}
+		if item.Side == "credit" {
+			credits = append(credits, transaction)
+		} else {
+			debits = append(debits, transaction)
+		}
+	}
+	for _, input := range inputs {
+		for i, id := range input.ids {
+			if j, ok := index[id]; !ok || items[j].ClosedPeriod != "" {
+				key := lineageID(input.side, input.transactions[i])
+				lineages[key] = append(lineages[key], id)
+			}
+		}
+	}
+
+	matchedTransactions, unmatchedCredits, unmatchedDebits := reconcileTraced(credits, debits, days, threshold, trace)
+
+	// Hand out the lineages of each lineageID to the transactions that
+	// carry it, matched ones first
+	next := func(side string, transaction Transaction) string {
+		key := lineageID(side, transaction)
+		ids := lineages[key]
+		if len(ids) == 0 {
+			return key
+		}
+		lineages[key] = ids[1:]
+		return ids[0]
+	}
+
+	for _, transactions := range matchedTransactions {
+		for i, side := range groupSides(transactions) {
+			if j, ok := index[next(side, transactions[i])]; ok && items[j].ClosedPeriod == "" {
+				items[j].ClosedPeriod = period
+			}
+		}
+	}
+
+	open := func(side string, transaction Transaction) {
+		id := next(side, transaction)
+		if j, ok := index[id]; ok {
+			// Reopen an item that matched in an earlier period
+			if items[j].ClosedPeriod != "" {
+				items[j].OpenedPeriod, items[j].ClosedPeriod = period, ""
+			}
+			return
+		}
+		index[id] = len(items)
+		items = append(items, openItem{
+			ID:           id,
+			Side:         side,
+			No:           transaction.No,
+			Date:         transaction.Date.Format(exportDateLayout),
+			Amount:       transaction.Value,
+			Source:       transaction.Source,
+			OpenedPeriod: period,
+		})
+	}
+	for _, credit := range unmatchedCredits {
+		open("credit", credit.Transaction)
+	}
+	for _, debit := range unmatchedDebits {
+		open("debit", debit.Transaction)
+	}
+
+	if err := s.save(items); err != nil {
+		return nil, nil, nil, fmt.Errorf("saving open items: %w", err)
+	}
+
+	return matchedTransactions, unmatchedCredits, unmatchedDebits, nil
+}
+
+// Open items of the store with their age on asOf, oldest first
+func (s *openItemStore) list(asOf time.Time) ([]agedOpenItem, error) {
+	s.mu.Lock()
+	items, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	aged := []agedOpenItem{}
+	for _, item := range items {
+		if item.ClosedPeriod != "" {
+			continue
+		}
+		date, err := time.Parse(exportDateLayout, item.Date)
+		if err != nil {
+			return nil, fmt.Errorf("open item %s: %w", item.ID, err)
+		}
+		aged = append(aged, agedOpenItem{openItem: item, AgeDays: dateDifferenceInDays(asOf, date)})
+	}
+
+	sort.SliceStable(aged, func(i, j int) bool {
+		return aged[i].AgeDays > aged[j].AgeDays
+	})
+	return aged, nil
+}
+
+// Format open items as a text table
+func formatOpenItems(items []agedOpenItem) string {
+	if len(items) == 0 {
+		return "No open items\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-7s %-20s %-12s %14s %8s  %s\n", "Side", "Transaction No", "Date", "Amount", "Age", "Opened")
+	for _, item := range items {
+		fmt.Fprintf(&b, "%-7s %-20s %-12s %14s %8d  %s\n", item.Side, item.No, item.Date, formatMoney(item.Amount), item.AgeDays, item.OpenedPeriod)
+	}
+	return b.String()
+}
+
+// Handler that lists the open items of the store as JSON, with their age in
+// days on the optional "as_of" date (YYYY-MM-DD), today by default
+func openItemsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if openItems == nil {
+		http.Error(w, "No open-items store configured", http.StatusNotFound)
+		return
+	}
+
+	asOf := time.Now()
+	if value := r.URL.Query().Get("as_of"); value != "" {
+		var err error
+		asOf, err = time.Parse(exportDateLayout, value)
+		if err != nil {
+			http.Error(w, "Invalid as_of date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := openItems.list(asOf)
+	if err != nil {
+		http.Error(w, "Error reading open items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		http.Error(w, "Error encoding open items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaJSON)
+	w.Write(body)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Items of a store as "no opened-closed", sorted
+func storeItems(t *testing.T, store *openItemStore) []string {
+	t.Helper()
+	items, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprintf("%s %s-%s", item.No, item.OpenedPeriod, item.ClosedPeriod))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestOpenItemStoreCarriesItemsForward(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "open-items.json")
+	for _, run := range []struct {
+		period          string
+		credits, debits []Transaction
+		matched         [][]string
+		items           []string
+	}{
+		{
+			period:  "2024-01",
+			credits: []Transaction{jan("C1", 5, 100), jan("C2", 6, 50)},
+			debits:  []Transaction{jan("D1", 6, 100)},
+			matched: [][]string{{"C1", "D1"}},
+			items:   []string{"C2 2024-01-"},
+		},
+		{
+			// C2 is carried in from the store and closes
+			period:  "2024-02",
+			debits:  []Transaction{jan("D2", 8, 50)},
+			matched: [][]string{{"C2", "D2"}},
+			items:   []string{"C2 2024-01-2024-02"},
+		},
+		{
+			// C2 turns up unmatched again and is reopened
+			period:  "2024-03",
+			credits: []Transaction{jan("C2", 6, 50)},
+			matched: [][]string{},
+			items:   []string{"C2 2024-03-"},
+		},
+	} {
+		// A store of its own for each run, read back from disk
+		store := newOpenItemStore(path)
+		matched, _, _, err := store.reconcile(run.period, run.credits, run.debits, 7, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(groupNos(matched)); got != fmt.Sprint(run.matched) {
+			t.Errorf("%s: matched %s, want %v", run.period, got, run.matched)
+		}
+		if got := storeItems(t, store); strings.Join(got, ", ") != strings.Join(run.items, ", ") {
+			t.Errorf("%s: store holds %v, want %v", run.period, got, run.items)
+		}
+	}
+
+	open, err := newOpenItemStore(path).list(time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].No != "C2" || open[0].AgeDays != 10 {
+		t.Errorf("open items %+v, want C2 aged 10 days", open)
+	}
+}
+
+func TestOpenItemStoreKeepsIdenticalTransactionsApart(t *testing.T) {
+	store := newOpenItemStore(filepath.Join(t.TempDir(), "open-items.json"))
+	twice := []Transaction{jan("DUP", 9, 40), jan("DUP", 9, 40)}
+
+	for _, run := range []struct {
+		period          string
+		credits, debits []Transaction
+		open            int
+	}{
+		{period: "2024-01", credits: twice, debits: []Transaction{jan("D1", 9, 40)}, open: 1},
+		{period: "2024-02", debits: []Transaction{jan("D2", 9, 40)}, open: 0},
+		{period: "2024-03", credits: twice, open: 2},
+	} {
+		_, unmatchedCredits, _, err := store.reconcile(run.period, run.credits, run.debits, 7, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		open, err := store.list(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(open) != run.open || len(unmatchedCredits) != run.open {
+			t.Errorf("%s: %d open items and %d unmatched credits, want %d", run.period, len(open), len(unmatchedCredits), run.open)
+		}
+	}
+
+	items, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, item := range items {
+		if item.No == "DUP" {
+			ids[item.ID] = true
+		}
+	}
+	if len(ids) != 2 {
+		t.Errorf("lineages of DUP %v, want two", ids)
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	runAt := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value, want string
+		err         bool
+	}{
+		{value: "", want: "2024-05"},
+		{value: "2023-12", want: "2023-12"},
+		{value: "2023-13", err: true},
+		{value: "2023-1", err: true},
+		{value: "Q1 2024", err: true},
+	} {
+		got, err := parsePeriod(tc.value, runAt)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("parsePeriod(%q) = %q, %v; want %q, error %v", tc.value, got, err, tc.want, tc.err)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin/cleaner"
+	"github.com/gin-gonic/gin/ingest"
+	"github.com/xuri/excelize/v2"
+)
+
+// Load the cleaning profile for the -profile command-line option, or the
+// default profile when none is given
+func loadCleanProfile(profilePath string) (cleaner.Profile, error) {
+	if profilePath == "" {
+		return cleaner.DefaultProfile, nil
+	}
+	return cleaner.LoadProfile(profilePath)
+}
+
+// Write a copy of the workbook annotated with the match results for the
+// -annotate command-line option
+func writeAnnotatedWorkbook(filename string, workbookPath string, profile cleaner.Profile, password string, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) error {
+	if password == "" {
+		password = profile.Password
+	}
+
+	workbook, err := os.Open(workbookPath)
+	if err != nil {
+		return err
+	}
+	defer workbook.Close()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return annotateWorkbook(workbook, password, matchedTransactions, unmatchedCredits, unmatchedDebits, file)
+}
+
+// Handler that cleans an uploaded workbook and reconciles it in one request.
+// The form takes the workbook as "file", an optional JSON cleaning profile
+// as "profile" and an optional "password", plus the usual "days" and
+// "threshold". A bank statement, or a journal with its "account", holding
+// both sides can be given as "file" instead of a workbook.
+//
+// The response is a zip of the text, Excel and HTML reports and the matched
+// and unmatched transactions, as CSV or, with "export" set to json, as JSON.
+// With the book_opening, book_closing, bank_opening and bank_closing
+// balances set, and optionally book_side, the text report ends with a bank
+// reconciliation statement. A JSON "adjustments" configuration adds the
+// adjusting entries of the run, and "annotate" set to true annotated.xlsx,
+// a copy of the workbook with the match results next to each source row.
+func pipelineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error retrieving workbook", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil {
+		http.Error(w, "Invalid days value", http.StatusBadRequest)
+		return
+	}
+
+	threshold, err := strconv.ParseFloat(r.FormValue("threshold"), 64)
+	if err != nil {
+		http.Error(w, "Invalid threshold value", http.StatusBadRequest)
+		return
+	}
+
+	exportFormat := exportCSV
+	if format := r.FormValue("export"); format != "" {
+		if format != exportCSV && format != exportJSON {
+			http.Error(w, "Invalid export format", http.StatusBadRequest)
+			return
+		}
+		exportFormat = format
+	}
+
+	profile := cleaner.DefaultProfile
+	if profileJSON := r.FormValue("profile"); profileJSON != "" {
+		profile, err = cleaner.ParseProfile([]byte(profileJSON))
+		if err != nil {
+			http.Error(w, "Invalid cleaning profile: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	statement, err := parseStatementForm(r)
+	if err != nil {
+		http.Error(w, "Invalid statement balances: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var adjustmentsConfig adjustmentConfig
+	adjustmentsJSON := r.FormValue("adjustments")
+	if adjustmentsJSON != "" {
+		adjustmentsConfig, err = parseAdjustmentConfig([]byte(adjustmentsJSON), "csv")
+		if err != nil {
+			http.Error(w, "Invalid adjustment configuration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The workbook is read twice when it gets annotated
+	workbook, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Error reading workbook", http.StatusBadRequest)
+		return
+	}
+
+	password := r.FormValue("password")
+	if password == "" {
+		password = profile.Password
+	}
+
+	document, err := ingest.Parse(header.Filename, workbook, ingest.Options{
+		Account:  r.FormValue("account"),
+		Profile:  &profile,
+		Password: password,
+	})
+	if errors.Is(err, excelize.ErrWorkbookPassword) || errors.Is(err, zip.ErrFormat) || errors.Is(err, ingest.ErrUnknownFormat) {
+		http.Error(w, "Error cleaning workbook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error cleaning workbook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, entry := range document.Entries {
+		if entry.Side == "" {
+			http.Error(w, "A "+document.Format+" file holds a single side; use /upload", http.StatusBadRequest)
+			return
+		}
+	}
+	annotate, _ := strconv.ParseBool(r.FormValue("annotate"))
+	if annotate && document.Format != "xlsx" {
+		http.Error(w, "Only workbooks can be annotated", http.StatusBadRequest)
+		return
+	}
+	credits, debits := documentTransactions(document, "credit", false), documentTransactions(document, "debit", false)
+
+	if statement != nil && r.FormValue("bank_opening") == "" && r.FormValue("bank_closing") == "" {
+		var bankStatement *ingest.Document
+		if document.Kind == ingest.KindStatement {
+			bankStatement = &document
+		}
+		if err := fillBankBalances(statement, bankStatement); err != nil {
+			http.Error(w, "Invalid statement balances: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	params := runParameters{
+		Days:      days,
+		Threshold: threshold,
+		Inputs:    []inputFile{hashInput(header.Filename, workbook)},
+		RunAt:     time.Now(),
+		Statement: statement,
+	}
+	if err := parseAgingQuery(r, &params); err != nil {
+		http.Error(w, "Invalid aging parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var trace *decisionTrace
+	if decisionLog != nil {
+		params.RunID = newRunID()
+		trace = newDecisionTrace()
+	}
+	matchedTransactions, unmatchedCredits, unmatchedDebits := reconcileTraced(credits, debits, days, threshold, trace)
+	if decisionLog != nil {
+		if err := decisionLog.append(params, trace); err != nil {
+			http.Error(w, "Error writing decision log: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	report := generateRunReport(params, matchedTransactions, unmatchedCredits, unmatchedDebits)
+	excelReport := new(bytes.Buffer)
+	if err := writeExcelReport(excelReport, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+		http.Error(w, "Error creating Excel report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	htmlReport := new(bytes.Buffer)
+	if err := writeHTMLReport(htmlReport, params, matchedTransactions, unmatchedCredits, unmatchedDebits, nil, nil); err != nil {
+		http.Error(w, "Error creating HTML report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	extras := []resultFile{
+		{Name: "report.xlsx", Data: excelReport.Bytes()},
+		{Name: "report.html", Data: htmlReport.Bytes()},
+	}
+
+	if adjustmentsJSON != "" {
+		adjustments := new(bytes.Buffer)
+		if err := writeAdjustments(adjustments, adjustmentsConfig, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+			http.Error(w, "Error creating adjustments: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		extras = append(extras, resultFile{Name: adjustmentFileName(adjustmentsConfig), Data: adjustments.Bytes()})
+	}
+
+	if annotate {
+		annotated := new(bytes.Buffer)
+		if err := annotateWorkbook(bytes.NewReader(workbook), password, matchedTransactions, unmatchedCredits, unmatchedDebits, annotated); err != nil {
+			http.Error(w, "Error annotating workbook: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		extras = append(extras, resultFile{Name: "annotated.xlsx", Data: annotated.Bytes()})
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeResultZip(buf, report, exportFormat, params, matchedTransactions, unmatchedCredits, unmatchedDebits, extras...); err != nil {
+		http.Error(w, "Error creating zip file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=reconciliation.zip")
+	w.Write(buf.Bytes())
+}
+
+// Additional file added to a result zip
+type resultFile struct {
+	Name string
+	Data []byte
+}
+
+// Write the report, the matched and unmatched transactions in the export
+// format and any extra files into a zip archive
+func writeResultZip(w io.Writer, report string, format string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, extras ...resultFile) error {
+	zipWriter := zip.NewWriter(w)
+
+	reportFile, err := zipWriter.Create("report.txt")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(reportFile, report); err != nil {
+		return err
+	}
+
+	for _, export := range exportFiles(format, params, matchedTransactions, unmatchedCredits, unmatchedDebits) {
+		exportWriter, err := zipWriter.Create(export.Name)
+		if err != nil {
+			return err
+		}
+		if err := writeExport(exportWriter, format, export.Rows); err != nil {
+			return err
+		}
+	}
+
+	for _, extra := range extras {
+		extraFile, err := zipWriter.Create(extra.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := extraFile.Write(extra.Data); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
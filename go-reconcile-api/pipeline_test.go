@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Cleaning profile of the workbooks of testWorkbook
+const testProfile = `{"SkipTop": 1, "SkipBottom": 0, "ExactSkip": true, "MinColumns": 3, "RefColumn": 0, "DateColumn": 1, "AmountColumn": 2}`
+
+// Workbook with a header row and the given rows, reference, date and
+// amount, on its credit and debit sheets
+func testWorkbook(t *testing.T, credits, debits [][]interface{}) []byte {
+	header := []interface{}{"Reference", "Date", "Amount"}
+	return sheetsWorkbook(t, map[string][][]interface{}{
+		"Sheet1": append([][]interface{}{header}, credits...),
+		"Sheet2": append([][]interface{}{header}, debits...),
+	})
+}
+
+// Workbook of the given rows by sheet, from row 1
+func sheetsWorkbook(t *testing.T, sheets map[string][][]interface{}) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for sheet, rows := range sheets {
+		if index, _ := f.GetSheetIndex(sheet); index == -1 {
+			if _, err := f.NewSheet(sheet); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, row := range rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// File field of a test form
+type formFile struct {
+	Field, Name string
+	Data        []byte
+}
+
+// Post a multipart form with files and fields to a handler
+func postForm(t *testing.T, handler http.HandlerFunc, files []formFile, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	for _, file := range files {
+		part, err := form.CreateFormFile(file.Field, file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(file.Data)
+	}
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// Files of a zip response by name
+func zipFiles(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, zf := range zipReader.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[zf.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestPipelineHandler(t *testing.T) {
+	workbook := testWorkbook(t,
+		[][]interface{}{{"C1", "2024-01-05", 100}, {"C2", "2024-01-06", 250}},
+		[][]interface{}{{"D1", "2024-01-05", 100}, {"D2", "2024-01-20", 75}})
+	statement := []byte(`<OFX><BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>100.00<FITID>F1</STMTTRN>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>-100.00<FITID>F2</STMTTRN>
+</BANKTRANLIST></OFX>`)
+	run := map[string]string{"days": "7", "threshold": "0", "profile": testProfile}
+
+	for _, tc := range []struct {
+		name      string
+		file      string
+		data      []byte
+		fields    map[string]string
+		status    int
+		error     string
+		files     []string
+		unmatched string // contents expected in unmatched_credits.csv
+	}{
+		{name: "workbook", file: "export.xlsx", data: workbook, fields: run, status: http.StatusOK,
+			files: []string{"report.txt", "matched_transactions.csv", "unmatched_credits.csv", "unmatched_debits.csv", "report.xlsx", "report.html"}, unmatched: "C2"},
+		{name: "annotated", file: "export.xlsx", data: workbook, fields: map[string]string{"days": "7", "threshold": "0", "profile": testProfile, "annotate": "true"}, status: http.StatusOK,
+			files: []string{"annotated.xlsx"}},
+		{name: "statement", file: "stmt.ofx", data: statement, fields: run, status: http.StatusOK, files: []string{"report.txt"}},
+		{name: "profile beyond MinColumns", file: "export.xlsx", data: workbook, fields: map[string]string{"days": "7", "threshold": "0", "profile": `{"MinColumns": 1, "AmountColumn": 50}`},
+			status: http.StatusBadRequest, error: "Invalid cleaning profile"},
+		{name: "negative skip", file: "export.xlsx", data: workbook, fields: map[string]string{"days": "7", "threshold": "0", "profile": `{"SkipTop": -1}`},
+			status: http.StatusBadRequest, error: "Invalid cleaning profile"},
+		{name: "bad days", file: "export.xlsx", data: workbook, fields: map[string]string{"days": "x", "threshold": "0"}, status: http.StatusBadRequest, error: "Invalid days value"},
+		{name: "one side", file: "credits.csv", data: []byte("C1,1/5/2024,100\n"), fields: run, status: http.StatusBadRequest, error: "holds a single side"},
+		{name: "annotated statement", file: "stmt.ofx", data: statement, fields: map[string]string{"days": "7", "threshold": "0", "annotate": "true"},
+			status: http.StatusBadRequest, error: "Only workbooks can be annotated"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postForm(t, pipelineHandler, []formFile{{"file", tc.file, tc.data}}, tc.fields)
+			if rec.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if tc.status != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), tc.error) {
+					t.Errorf("error %q, want %q", rec.Body, tc.error)
+				}
+				return
+			}
+			files := zipFiles(t, rec.Body.Bytes())
+			for _, name := range tc.files {
+				if len(files[name]) == 0 {
+					t.Errorf("zip has no %s, only %d files", name, len(files))
+				}
+			}
+			if tc.unmatched != "" && !strings.Contains(string(files["unmatched_credits.csv"]), tc.unmatched) {
+				t.Errorf("unmatched_credits.csv has no %s:\n%s", tc.unmatched, files["unmatched_credits.csv"])
+			}
+		})
+	}
+}
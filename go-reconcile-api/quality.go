@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/ingest"
+)
+
+// Default fence of the outlier test, in interquartile ranges beyond the
+// quartiles
+const defaultOutlierIQR = 3.0
+
+// Settings of the data quality profile. Holidays are YYYY-MM-DD dates items
+// shouldn't fall on, and OutlierIQR the fence of the outlier test. The limits
+// block the reconciliation when a file or side goes over them; a limit left
+// out doesn't apply, so without any the profile only reports. Duplicate
+// limits count the transaction numbers or (date, amount) pairs that appear
+// more than once.
+type qualityConfig struct {
+	Holidays            []string `json:"holidays"`
+	OutlierIQR          float64  `json:"outlier_iqr"`
+	MaxRejected         *int     `json:"max_rejected,omitempty"`
+	MaxRejectedRate     *float64 `json:"max_rejected_rate,omitempty"`
+	MaxOutliers         *int     `json:"max_outliers,omitempty"`
+	MaxZeroAmounts      *int     `json:"max_zero_amounts,omitempty"`
+	MaxNegativeAmounts  *int     `json:"max_negative_amounts,omitempty"`
+	MaxDuplicateNumbers *int     `json:"max_duplicate_numbers,omitempty"`
+	MaxDuplicatePairs   *int     `json:"max_duplicate_pairs,omitempty"`
+	MaxWeekendItems     *int     `json:"max_weekend_items,omitempty"`
+	MaxHolidayItems     *int     `json:"max_holiday_items,omitempty"`
+}
+
+// Data quality profile of the inputs of a run. Blocked is set when any
+// file or side goes over a limit, and Violations says which.
+type qualityReport struct {
+	Files      []fileProfile `json:"files"`
+	Violations []string      `json:"violations"`
+	Blocked    bool          `json:"blocked"`
+}
+
+// Profile of one input file. Rows counts the rows read, rejected ones
+// included. A file holding both sides has a profile for each.
+type fileProfile struct {
+	File     string        `json:"file"`
+	Rows     int           `json:"rows"`
+	Rejected int           `json:"rejected"`
+	Sides    []sideProfile `json:"sides"`
+}
+
+// Profile of the transactions of one side of a file. Dates are YYYY-MM-DD
+// and empty without transactions.
+type sideProfile struct {
+	Side             string              `json:"side"`
+	Transactions     int                 `json:"transactions"`
+	FirstDate        string              `json:"first_date"`
+	LastDate         string              `json:"last_date"`
+	Amounts          amountDistribution  `json:"amounts"`
+	Outliers         []resultTransaction `json:"outliers"`
+	ZeroAmounts      int                 `json:"zero_amounts"`
+	NegativeAmounts  int                 `json:"negative_amounts"`
+	DuplicateNumbers []duplicateNumber   `json:"duplicate_numbers"`
+	DuplicatePairs   []duplicatePair     `json:"duplicate_pairs"`
+	WeekendItems     int                 `json:"weekend_items"`
+	HolidayItems     int                 `json:"holiday_items"`
+}
+
+// Distribution of the amounts of a side. Amounts outside the fences are
+// outliers.
+type amountDistribution struct {
+	Total      float64 `json:"total"`
+	Min        float64 `json:"min"`
+	Q1         float64 `json:"q1"`
+	Median     float64 `json:"median"`
+	Q3         float64 `json:"q3"`
+	Max        float64 `json:"max"`
+	Mean       float64 `json:"mean"`
+	LowerFence float64 `json:"lower_fence"`
+	UpperFence float64 `json:"upper_fence"`
+}
+
+// Transaction number that appears more than once on a side
+type duplicateNumber struct {
+	No    string `json:"no"`
+	Count int    `json:"count"`
+}
+
+// Date and amount shared by more than one transaction of a side
+type duplicatePair struct {
+	Date   string   `json:"date"`
+	Amount float64  `json:"amount"`
+	Nos    []string `json:"nos"`
+}
+
+// Parse a data quality configuration and fill in its defaults
+func parseQualityConfig(data []byte) (qualityConfig, error) {
+	var config qualityConfig
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, err
+		}
+	}
+
+	if config.OutlierIQR == 0 {
+		config.OutlierIQR = defaultOutlierIQR
+	}
+	if config.OutlierIQR < 0 {
+		return config, fmt.Errorf("invalid outlier_iqr %g", config.OutlierIQR)
+	}
+	for _, holiday := range config.Holidays {
+		if _, err := time.Parse(exportDateLayout, holiday); err != nil {
+			return config, fmt.Errorf("invalid holiday %q, expected YYYY-MM-DD", holiday)
+		}
+	}
+	if config.MaxRejectedRate != nil && (*config.MaxRejectedRate < 0 || *config.MaxRejectedRate > 1) {
+		return config, fmt.Errorf("invalid max_rejected_rate %g, expected 0 to 1", *config.MaxRejectedRate)
+	}
+	return config, nil
+}
+
+// Read the data quality configuration for the -quality-config option, or
+// the defaults when none is given
+func loadQualityConfig(configPath string) (qualityConfig, error) {
+	if configPath == "" {
+		return parseQualityConfig(nil)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return qualityConfig{}, err
+	}
+	return parseQualityConfig(data)
+}
+
+// Profile an input file from the document read from it, before it's split
+// into the sides of a run: rows are all its entries and rejected rows. A
+// file whose entries are tagged by side, or given for no side as -w and
+// stream input are, is profiled on both sides; entries without a side are on
+// the side the file is given for. Signed keeps the signs of the amounts, as
+// statement mode does.
+func profileFile(config qualityConfig, file string, document ingest.Document, side string, signed bool) fileProfile {
+	profile := fileProfile{
+		File:     file,
+		Rows:     len(document.Entries) + len(document.Rejected),
+		Rejected: len(document.Rejected),
+		Sides:    []sideProfile{},
+	}
+
+	sides := []string{"credit", "debit"}
+	if side != "" && !slices.ContainsFunc(document.Entries, func(entry ingest.Entry) bool { return entry.Side != "" }) {
+		sides = []string{side}
+	}
+	for _, s := range sides {
+		part := document
+		part.Entries = nil
+		for _, entry := range document.Entries {
+			if entry.Side == "" || entry.Side == s {
+				part.Entries = append(part.Entries, entry)
+			}
+		}
+		profile.Sides = append(profile.Sides, profileSide(config, s, documentTransactions(part, s, signed)))
+	}
+	return profile
+}
+
+// Profile the transactions of one side
+func profileSide(config qualityConfig, side string, transactions []Transaction) sideProfile {
+	profile := sideProfile{
+		Side:             side,
+		Transactions:     len(transactions),
+		Outliers:         []resultTransaction{},
+		DuplicateNumbers: []duplicateNumber{},
+		DuplicatePairs:   []duplicatePair{},
+	}
+	if len(transactions) == 0 {
+		return profile
+	}
+
+	holidays := make(map[string]bool, len(config.Holidays))
+	for _, holiday := range config.Holidays {
+		holidays[holiday] = true
+	}
+
+	amounts := make([]float64, len(transactions))
+	first, last := transactions[0].Date, transactions[0].Date
+	numbers := make(map[string]int)
+	pairs := make(map[string]*duplicatePair)
+	var pairKeys []string
+	for i, transaction := range transactions {
+		amounts[i] = transaction.Value
+		profile.Amounts.Total += transaction.Value
+		if transaction.Date.Before(first) {
+			first = transaction.Date
+		}
+		if transaction.Date.After(last) {
+			last = transaction.Date
+		}
+
+		switch {
+		case roundCents(transaction.Value) == 0:
+			profile.ZeroAmounts++
+		case transaction.Value < 0:
+			profile.NegativeAmounts++
+		}
+
+		date := transaction.Date.Format(exportDateLayout)
+		switch transaction.Date.Weekday() {
+		case time.Saturday, time.Sunday:
+			profile.WeekendItems++
+		}
+		if holidays[date] {
+			profile.HolidayItems++
+		}
+
+		numbers[transaction.No]++
+		key := fmt.Sprintf("%s:%.2f", date, transaction.Value)
+		pair, ok := pairs[key]
+		if !ok {
+			pair = &duplicatePair{Date: date, Amount: roundCents(transaction.Value)}
+			pairs[key] = pair
+			pairKeys = append(pairKeys, key)
+		}
+		pair.Nos = append(pair.Nos, transaction.No)
+	}
+	profile.FirstDate = first.Format(exportDateLayout)
+	profile.LastDate = last.Format(exportDateLayout)
+	profile.Amounts.Total = roundCents(profile.Amounts.Total)
+
+	sort.Float64s(amounts)
+	distribution := &profile.Amounts
+	distribution.Min, distribution.Max = amounts[0], amounts[len(amounts)-1]
+	distribution.Q1 = roundCents(quantile(amounts, 0.25))
+	distribution.Median = roundCents(quantile(amounts, 0.5))
+	distribution.Q3 = roundCents(quantile(amounts, 0.75))
+	distribution.Mean = roundCents(distribution.Total / float64(len(amounts)))
+	iqr := distribution.Q3 - distribution.Q1
+	distribution.LowerFence = roundCents(distribution.Q1 - config.OutlierIQR*iqr)
+	distribution.UpperFence = roundCents(distribution.Q3 + config.OutlierIQR*iqr)
+
+	for _, transaction := range transactions {
+		if transaction.Value < distribution.LowerFence || transaction.Value > distribution.UpperFence {
+			profile.Outliers = append(profile.Outliers, resultTransactions([]Transaction{transaction}, side)...)
+		}
+	}
+
+	for no, count := range numbers {
+		if count > 1 {
+			profile.DuplicateNumbers = append(profile.DuplicateNumbers, duplicateNumber{No: no, Count: count})
+		}
+	}
+	sort.Slice(profile.DuplicateNumbers, func(i, j int) bool {
+		return profile.DuplicateNumbers[i].No < profile.DuplicateNumbers[j].No
+	})
+	for _, key := range pairKeys {
+		if pair := pairs[key]; len(pair.Nos) > 1 {
+			profile.DuplicatePairs = append(profile.DuplicatePairs, *pair)
+		}
+	}
+
+	return profile
+}
+
+// Quantile of sorted values, interpolating between the closest two
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+// Profile the inputs of a run and check them against the limits of the
+// configuration
+func newQualityReport(config qualityConfig, files ...fileProfile) qualityReport {
+	report := qualityReport{Files: files, Violations: []string{}}
+	if report.Files == nil {
+		report.Files = []fileProfile{}
+	}
+
+	check := func(subject, what string, value int, limit *int) {
+		if limit != nil && value > *limit {
+			report.Violations = append(report.Violations, fmt.Sprintf("%s: %d %s, more than %d", subject, value, what, *limit))
+		}
+	}
+	for _, file := range files {
+		check(file.File, "rejected rows", file.Rejected, config.MaxRejected)
+		if config.MaxRejectedRate != nil && file.Rows > 0 {
+			if rate := float64(file.Rejected) / float64(file.Rows); rate > *config.MaxRejectedRate {
+				report.Violations = append(report.Violations, fmt.Sprintf("%s: %.1f%% of the rows rejected, more than %.1f%%", file.File, rate*100, *config.MaxRejectedRate*100))
+			}
+		}
+		for _, side := range file.Sides {
+			subject := file.File + " " + side.Side
+			check(subject, "outliers", len(side.Outliers), config.MaxOutliers)
+			check(subject, "zero amounts", side.ZeroAmounts, config.MaxZeroAmounts)
+			check(subject, "negative amounts", side.NegativeAmounts, config.MaxNegativeAmounts)
+			check(subject, "duplicate transaction numbers", len(side.DuplicateNumbers), config.MaxDuplicateNumbers)
+			check(subject, "duplicate (date, amount) pairs", len(side.DuplicatePairs), config.MaxDuplicatePairs)
+			check(subject, "items on weekends", side.WeekendItems, config.MaxWeekendItems)
+			check(subject, "items on holidays", side.HolidayItems, config.MaxHolidayItems)
+		}
+	}
+	report.Blocked = len(report.Violations) > 0
+
+	return report
+}
+
+// Format a data quality report as text
+func formatQuality(report qualityReport) string {
+	var sb strings.Builder
+	sb.WriteString("Data Quality Profile:\n")
+	for _, file := range report.Files {
+		sb.WriteString(fmt.Sprintf("%s: %d rows, %d rejected\n", file.File, file.Rows, file.Rejected))
+		for _, side := range file.Sides {
+			if side.Transactions == 0 {
+				sb.WriteString(fmt.Sprintf("  %s: no transactions\n", side.Side))
+				continue
+			}
+			amounts := side.Amounts
+			sb.WriteString(fmt.Sprintf("  %s: %d transactions from %s to %s\n", side.Side, side.Transactions, side.FirstDate, side.LastDate))
+			sb.WriteString(fmt.Sprintf("    Amounts: total %.2f, min %.2f, q1 %.2f, median %.2f, q3 %.2f, max %.2f, mean %.2f\n",
+				amounts.Total, amounts.Min, amounts.Q1, amounts.Median, amounts.Q3, amounts.Max, amounts.Mean))
+
+			var items []string
+			for _, outlier := range side.Outliers {
+				items = append(items, fmt.Sprintf("%s %.2f", outlier.No, outlier.Amount))
+			}
+			sb.WriteString(fmt.Sprintf("    Outliers outside %.2f to %.2f: %d%s\n", amounts.LowerFence, amounts.UpperFence, len(items), formatQualityItems(items)))
+
+			sb.WriteString(fmt.Sprintf("    Zero amounts: %d, negative amounts: %d\n", side.ZeroAmounts, side.NegativeAmounts))
+
+			items = nil
+			for _, duplicate := range side.DuplicateNumbers {
+				items = append(items, fmt.Sprintf("%s x%d", duplicate.No, duplicate.Count))
+			}
+			sb.WriteString(fmt.Sprintf("    Duplicate transaction numbers: %d%s\n", len(items), formatQualityItems(items)))
+
+			items = nil
+			for _, pair := range side.DuplicatePairs {
+				items = append(items, fmt.Sprintf("%s %.2f: %s", pair.Date, pair.Amount, strings.Join(pair.Nos, " ")))
+			}
+			sb.WriteString(fmt.Sprintf("    Duplicate (date, amount) pairs: %d%s\n", len(items), formatQualityItems(items)))
+
+			sb.WriteString(fmt.Sprintf("    Items on weekends: %d, on holidays: %d\n", side.WeekendItems, side.HolidayItems))
+		}
+	}
+
+	if report.Blocked {
+		sb.WriteString("\nReconciliation blocked:\n")
+		for _, violation := range report.Violations {
+			sb.WriteString("  " + violation + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// Items of a report line in parentheses, nothing when there are none
+func formatQualityItems(items []string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(items, ", ") + ")"
+}
+
+// Write a data quality report with a status, as JSON or text
+func writeQualityReport(w http.ResponseWriter, format string, status int, report qualityReport) {
+	w.Header().Add("Vary", "Accept")
+	if format == mediaJSON {
+		body, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			http.Error(w, "Error encoding data quality report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaJSON)
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(formatQuality(report)))
+}
+
+// Handler that profiles the data quality of uploaded inputs without
+// reconciling them. The form takes creditFile, debitFile or both, the
+// "account", "password" and CSV dialect fields of /upload and a JSON
+// configuration as "quality". The report is JSON or text by the Accept
+// header, whether the limits block a run or not.
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	config, err := parseQualityConfig([]byte(r.FormValue("quality")))
+	if err != nil {
+		http.Error(w, "Invalid data quality configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := inputOptions{Options: ingest.Options{Account: r.FormValue("account"), Password: r.FormValue("password"), CSV: ingest.FormDialect(r.FormValue)}}
+	if err := options.CSV.Validate(); err != nil {
+		http.Error(w, "Invalid CSV dialect: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var files []fileProfile
+	for _, side := range []string{"credit", "debit"} {
+		file, header, err := r.FormFile(side + "File")
+		if err == http.ErrMissingFile {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "Error retrieving "+side+" file", http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "Error reading "+side+" file", http.StatusBadRequest)
+			return
+		}
+		input, err := parseSideInput(header.Filename, data, side, options)
+		if err != nil {
+			http.Error(w, "Error parsing "+side+" file: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		files = append(files, profileFile(config, header.Filename, input.Document, side, options.Signed))
+	}
+	if len(files) == 0 {
+		http.Error(w, "Error retrieving credit or debit file", http.StatusBadRequest)
+		return
+	}
+
+	writeQualityReport(w, negotiateResultFormat(r), http.StatusOK, newQualityReport(config, files...))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProfileFileCountsWholeDocument(t *testing.T) {
+	statement := []byte(`<OFX><BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240105<TRNAMT>250.00<FITID>F1</STMTTRN>
+<STMTTRN><DTPOSTED>20240106<TRNAMT>-75.50<FITID>F2</STMTTRN>
+<STMTTRN><DTPOSTED>20240107<TRNAMT>-10.00<FITID>F3</STMTTRN>
+</BANKTRANLIST></OFX>`)
+	ledger := []byte("C1,1/5/2024,250.00\nC2,1/6/2024,oops\nC3,1/7/2024,10.00\n")
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		side     string
+		signed   bool
+		rows     int
+		rejected int
+		sides    []string // side:transactions
+	}{
+		{name: "stmt.ofx", data: statement, side: "credit", rows: 3, sides: []string{"credit:1", "debit:2"}},
+		{name: "stmt.ofx", data: statement, side: "debit", signed: true, rows: 3, sides: []string{"credit:1", "debit:2"}},
+		{name: "ledger.csv", data: ledger, side: "debit", rows: 3, rejected: 1, sides: []string{"debit:2"}},
+	} {
+		input, err := parseSideInput(tc.name, tc.data, tc.side, inputOptions{Signed: tc.signed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := parseQualityConfig(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile := profileFile(config, tc.name, input.Document, tc.side, tc.signed)
+
+		var sides []string
+		for _, side := range profile.Sides {
+			sides = append(sides, fmt.Sprintf("%s:%d", side.Side, side.Transactions))
+		}
+		if profile.Rows != tc.rows || profile.Rejected != tc.rejected || strings.Join(sides, ",") != strings.Join(tc.sides, ",") {
+			t.Errorf("%s as %s: %d rows, %d rejected, sides %v; want %d, %d, %v", tc.name, tc.side, profile.Rows, profile.Rejected, sides, tc.rows, tc.rejected, tc.sides)
+		}
+	}
+}
@@ -1,28 +1,35 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"mime/multipart"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/gin-gonic/gin/ingest"
 	"github.com/gorilla/mux"
 )
 
 // Transaction struct
 type Transaction struct {
-	No    string
-	Value float64
-	Date  time.Time
+	No          string
+	Value       float64
+	Date        time.Time
+	Source      string // Sheet row the cleaner read it from, e.g. Sheet1!27
+	Description string // Narrative of a bank statement entry
 }
 
 // CreditTransaction struct
@@ -72,6 +79,9 @@ func readCSV(filePath string, transactionType string) ([]Transaction, error) {
 			Value: value,
 			Date:  date,
 		}
+		if len(record) > 3 {
+			transaction.Source = record[3]
+		}
 
 		transactions = append(transactions, transaction)
 	}
@@ -79,8 +89,8 @@ func readCSV(filePath string, transactionType string) ([]Transaction, error) {
 	return transactions, nil
 }
 
-// Reconcile transactions
-func reconcile(credits []CreditTransaction, debits []DebitTransaction, days int, threshold float64) ([][]Transaction, []CreditTransaction, []DebitTransaction) {
+// Reconcile transactions, recording each decision to trace when it isn't nil
+func reconcile(credits []CreditTransaction, debits []DebitTransaction, days int, threshold float64, trace *decisionTrace) ([][]Transaction, []CreditTransaction, []DebitTransaction) {
 	var matchedTransactions [][]Transaction
 	var unmatchedCredits []CreditTransaction
 	var unmatchedDebits []DebitTransaction
@@ -95,19 +105,33 @@ func reconcile(credits []CreditTransaction, debits []DebitTransaction, days int,
 	for i := 0; i < len(credits); {
 		credit := credits[i]
 		matched := false
+		trace.begin("credit", credit.Transaction)
 		for j := 0; j < len(debits); {
 			debit := debits[j]
 			if credit.Value == debit.Value && dateDifferenceInDays(credit.Date, debit.Date) <= days {
-				matchedTransactions = append(matchedTransactions, []Transaction{credit.Transaction, debit.Transaction})
+				group := []Transaction{credit.Transaction, debit.Transaction}
+				trace.examine("debit", debit.Transaction, "")
+				trace.examineConsumed("debit", func(consumed Transaction) bool {
+					return credit.Value == consumed.Value && dateDifferenceInDays(credit.Date, consumed.Date) <= days
+				})
+				trace.match(group)
+				matchedTransactions = append(matchedTransactions, group)
 				credits = append(credits[:i], credits[i+1:]...)
 				debits = append(debits[:j], debits[j+1:]...)
 				matched = true
 				break
 			} else {
+				if credit.Value != debit.Value {
+					trace.examine("debit", debit.Transaction, rejectAmount)
+				} else {
+					trace.examine("debit", debit.Transaction, rejectDateWindow)
+				}
 				j++
 			}
 		}
 		if !matched {
+			// Credits without a one-to-one match are left to the many-to-one pass
+			trace.discard()
 			i++
 		}
 	}
@@ -115,22 +139,37 @@ func reconcile(credits []CreditTransaction, debits []DebitTransaction, days int,
 	for _, debit := range debits {
 		var matchedCredits []CreditTransaction
 		remainingDebitValue := debit.Value
+		trace.begin("debit", debit.Transaction)
 
 		for i := 0; i < len(credits); {
-			if credits[i].Value <= remainingDebitValue && dateDifferenceInDays(credits[i].Date, debit.Date) <= days {
+			if fitsManyToOne(credits[i].Value, remainingDebitValue) && dateDifferenceInDays(credits[i].Date, debit.Date) <= days {
+				trace.examine("credit", credits[i].Transaction, "")
 				remainingDebitValue -= credits[i].Value
 				matchedCredits = append(matchedCredits, credits[i])
 				credits[i] = credits[len(credits)-1]
 				credits = credits[:len(credits)-1]
 			} else {
+				if !fitsManyToOne(credits[i].Value, remainingDebitValue) {
+					trace.examine("credit", credits[i].Transaction, rejectAmount)
+				} else {
+					trace.examine("credit", credits[i].Transaction, rejectDateWindow)
+				}
 				i++
 			}
 		}
+		trace.examineConsumed("credit", func(consumed Transaction) bool {
+			return fitsManyToOne(consumed.Value, debit.Value) && dateDifferenceInDays(consumed.Date, debit.Date) <= days
+		})
 
 		if remainingDebitValue >= -threshold && remainingDebitValue <= threshold {
-			matchedTransactions = append(matchedTransactions, append([]Transaction{debit.Transaction}, convertToTransactions(matchedCredits)...))
+			group := append([]Transaction{debit.Transaction}, convertToTransactions(matchedCredits)...)
+			trace.match(group)
+			matchedTransactions = append(matchedTransactions, group)
 		} else {
+			trace.noMatch(ruleManyToOne, remainingDebitValue)
 			unmatchedDebits = append(unmatchedDebits, debit)
+			// Return the credits of the failed group to the pool
+			credits = append(credits, matchedCredits...)
 		}
 	}
 
@@ -139,6 +178,34 @@ func reconcile(credits []CreditTransaction, debits []DebitTransaction, days int,
 	return matchedTransactions, unmatchedCredits, unmatchedDebits
 }
 
+// Whether a credit fits in what is left of a debit in the many-to-one pass.
+// Statement mode keeps the signs, so a credit has to have the sign of the
+// debit, and a receipt never offsets a payment.
+func fitsManyToOne(credit, remaining float64) bool {
+	return (credit < 0) == (remaining < 0) && math.Abs(credit) <= math.Abs(remaining)
+}
+
+// Tag parsed transactions with their side and reconcile them
+func reconcileTransactions(credits []Transaction, debits []Transaction, days int, threshold float64) ([][]Transaction, []CreditTransaction, []DebitTransaction) {
+	return reconcileTraced(credits, debits, days, threshold, nil)
+}
+
+// Reconcile parsed transactions like reconcileTransactions, recording the
+// decisions to trace
+func reconcileTraced(credits []Transaction, debits []Transaction, days int, threshold float64, trace *decisionTrace) ([][]Transaction, []CreditTransaction, []DebitTransaction) {
+	creditTransactions := make([]CreditTransaction, len(credits))
+	for i, credit := range credits {
+		creditTransactions[i] = CreditTransaction{Transaction: credit, Type: "credit"}
+	}
+
+	debitTransactions := make([]DebitTransaction, len(debits))
+	for i, debit := range debits {
+		debitTransactions[i] = DebitTransaction{Transaction: debit, Type: "debit"}
+	}
+
+	return reconcile(creditTransactions, debitTransactions, days, threshold, trace)
+}
+
 // Calculate the difference in days between two dates
 func dateDifferenceInDays(date1, date2 time.Time) int {
 	diff := date1.Sub(date2)
@@ -164,6 +231,174 @@ func convertToTransactions(transactions interface{}) []Transaction {
 	return result
 }
 
+// Matching rules, in the order reconcile applies them
+const (
+	ruleOneToOne  = "one-to-one"
+	ruleManyToOne = "many-to-one"
+)
+
+// Settings and inputs of a reconciliation run, echoed in the reports.
+// AsOf (YYYY-MM-DD) and AgingBuckets set up the aging analysis and default
+// to the run date and 30,60,90; setting either also adds the aging section
+// to the text report. Statement holds the balances of statement
+// mode and is nil without it. RunID identifies the run in the decision log
+// and is empty when there's none.
+type runParameters struct {
+	RunID        string             `json:"run_id,omitempty"`
+	Days         int                `json:"days"`
+	Threshold    float64            `json:"threshold"`
+	Inputs       []inputFile        `json:"inputs"`
+	RunAt        time.Time          `json:"run_at"`
+	AsOf         string             `json:"as_of,omitempty"`
+	AgingBuckets []int              `json:"aging_buckets,omitempty"`
+	Statement    *statementBalances `json:"statement,omitempty"`
+}
+
+// Input file of a run and the SHA-256 of its contents
+type inputFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// Hash the contents of an input file
+func hashInput(name string, data []byte) inputFile {
+	sum := sha256.Sum256(data)
+	return inputFile{Name: name, SHA256: hex.EncodeToString(sum[:])}
+}
+
+// Hash an input file on disk
+func hashInputFile(filePath string) (inputFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return inputFile{}, err
+	}
+	return hashInput(filepath.Base(filePath), data), nil
+}
+
+// Rule that produced a matched group. The first pass stores exact matches
+// as credit, debit; the second stores a debit followed by the credits that
+// cover it. An equal pair can only come from the first pass, since the
+// second pass sees what the first one left.
+func matchRule(transactions []Transaction) string {
+	if len(transactions) == 2 && transactions[0].Value == transactions[1].Value {
+		return ruleOneToOne
+	}
+	return ruleManyToOne
+}
+
+// Side of each transaction of a matched group, see matchRule
+func groupSides(transactions []Transaction) []string {
+	sides := make([]string, len(transactions))
+	for i := range sides {
+		sides[i] = "credit"
+	}
+	if matchRule(transactions) == ruleOneToOne {
+		sides[1] = "debit"
+	} else {
+		sides[0] = "debit"
+	}
+	return sides
+}
+
+// Identifier of a matched group, numbered in the order reconcile found them
+func matchGroupID(index int) string {
+	return fmt.Sprintf("G%04d", index+1)
+}
+
+// Difference between the first transaction of a matched group and the rest,
+// rounded to cents. Zero for exact one-to-one matches, the part of the debit
+// not covered by its credits for many-to-one groups.
+func groupResidual(transactions []Transaction) float64 {
+	residual := transactions[0].Value
+	for _, transaction := range transactions[1:] {
+		residual -= transaction.Value
+	}
+	return math.Round(residual*100) / 100
+}
+
+// Widest gap in days between the first transaction of a matched group and
+// the others
+func groupDateGap(transactions []Transaction) int {
+	gap := 0
+	for _, transaction := range transactions[1:] {
+		diff := dateDifferenceInDays(transaction.Date, transactions[0].Date)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > gap {
+			gap = diff
+		}
+	}
+	return gap
+}
+
+// Counts and totals of a reconciliation run
+type reconSummary struct {
+	MatchedGroups        int     `json:"matched_groups"`
+	OneToOneGroups       int     `json:"one_to_one_groups"`
+	ManyToOneGroups      int     `json:"many_to_one_groups"`
+	GroupsWithResidual   int     `json:"groups_with_residual"`
+	ResidualTotal        float64 `json:"residual_total"`
+	MatchedCredits       int     `json:"matched_credits"`
+	MatchedCreditTotal   float64 `json:"matched_credit_total"`
+	MatchedDebits        int     `json:"matched_debits"`
+	MatchedDebitTotal    float64 `json:"matched_debit_total"`
+	UnmatchedCredits     int     `json:"unmatched_credits"`
+	UnmatchedCreditTotal float64 `json:"unmatched_credit_total"`
+	UnmatchedDebits      int     `json:"unmatched_debits"`
+	UnmatchedDebitTotal  float64 `json:"unmatched_debit_total"`
+	CreditMatchRate      float64 `json:"credit_match_rate"`
+	DebitMatchRate       float64 `json:"debit_match_rate"`
+}
+
+// Summarize the result of reconcile
+func summarize(matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) reconSummary {
+	var summary reconSummary
+
+	for _, transactions := range matchedTransactions {
+		summary.MatchedGroups++
+		if matchRule(transactions) == ruleOneToOne {
+			summary.OneToOneGroups++
+		} else {
+			summary.ManyToOneGroups++
+		}
+
+		if residual := groupResidual(transactions); residual != 0 {
+			summary.GroupsWithResidual++
+			summary.ResidualTotal += residual
+		}
+
+		for i, side := range groupSides(transactions) {
+			if side == "credit" {
+				summary.MatchedCredits++
+				summary.MatchedCreditTotal += transactions[i].Value
+			} else {
+				summary.MatchedDebits++
+				summary.MatchedDebitTotal += transactions[i].Value
+			}
+		}
+	}
+
+	for _, credit := range unmatchedCredits {
+		summary.UnmatchedCredits++
+		summary.UnmatchedCreditTotal += credit.Value
+	}
+	for _, debit := range unmatchedDebits {
+		summary.UnmatchedDebits++
+		summary.UnmatchedDebitTotal += debit.Value
+	}
+
+	if total := summary.MatchedCredits + summary.UnmatchedCredits; total > 0 {
+		summary.CreditMatchRate = float64(summary.MatchedCredits) / float64(total)
+	}
+	if total := summary.MatchedDebits + summary.UnmatchedDebits; total > 0 {
+		summary.DebitMatchRate = float64(summary.MatchedDebits) / float64(total)
+	}
+	summary.ResidualTotal = math.Round(summary.ResidualTotal*100) / 100
+
+	return summary
+}
+
 // Generate reconciliation report
 func generateReport(matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) string {
 	report := "Matched Transactions:\n"
@@ -206,38 +441,12 @@ func generateReport(matchedTransactions [][]Transaction, unmatchedCredits []Cred
 	return report
 }
 
-// Write transactions to a CSV file
-func writeTransactionsToCSV(filename string, transactions [][]Transaction) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	header := []string{"Transaction No", "Value", "Type"}
-	if err := writer.Write(header); err != nil {
-		return err
-	}
-
-	for _, transactionPair := range transactions {
-		for _, transaction := range transactionPair {
-			record := []string{transaction.No, fmt.Sprintf("%.2f", transaction.Value), "Unknown"}
-			if err := writer.Write(record); err != nil {
-				return err
-			}
-		}
-		if err := writer.Write([]string{}); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-// Handler for file uploads and reconciliation via web interface
+// Handler for file uploads and reconciliation via web interface. With a
+// JSON data quality configuration as "quality", {} for the defaults, the
+// inputs are profiled first and a run they fail is answered with the
+// report and 422 Unprocessable Entity. The entries of the other side of an
+// input tagged by side, such as the debits of a bank statement uploaded as
+// "creditFile", are left out and listed with the rejected rows.
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST")
@@ -254,14 +463,14 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	creditFile, _, err := r.FormFile("creditFile")
+	creditFile, creditHeader, err := r.FormFile("creditFile")
 	if err != nil {
 		http.Error(w, "Error retrieving credit file", http.StatusBadRequest)
 		return
 	}
 	defer creditFile.Close()
 
-	debitFile, _, err := r.FormFile("debitFile")
+	debitFile, debitHeader, err := r.FormFile("debitFile")
 	if err != nil {
 		http.Error(w, "Error retrieving debit file", http.StatusBadRequest)
 		return
@@ -283,127 +492,520 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	credits, err := parseCSVFile(creditFile, "credit")
+	params := runParameters{Days: days, Threshold: threshold, RunAt: time.Now()}
+
+	if err := parseAgingQuery(r, &params); err != nil {
+		http.Error(w, "Invalid aging parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params.Statement, err = parseStatementForm(r)
 	if err != nil {
-		http.Error(w, "Error parsing credit file: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid statement balances: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	debits, err := parseCSVFile(debitFile, "debit")
+	// The sweep runs after the open items and the decision log are saved,
+	// so its grid is checked before anything is
+	runSweep, _ := strconv.ParseBool(r.FormValue("sweep"))
+	sweepDays, sweepThresholds := defaultSweepDays, defaultSweepThresholds
+	if value := r.FormValue("sweep_days"); runSweep && value != "" {
+		if sweepDays, err = parseSweepDays(value); err != nil {
+			http.Error(w, "Invalid sweep_days: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.FormValue("sweep_thresholds"); runSweep && value != "" {
+		if sweepThresholds, err = parseSweepThresholds(value); err != nil {
+			http.Error(w, "Invalid sweep_thresholds: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var trace *decisionTrace
+	if decisionLog != nil {
+		params.RunID = newRunID()
+		trace = newDecisionTrace()
+	}
+
+	creditData, err := io.ReadAll(creditFile)
 	if err != nil {
-		http.Error(w, "Error parsing debit file: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error reading credit file", http.StatusBadRequest)
 		return
 	}
+	params.Inputs = append(params.Inputs, hashInput(creditHeader.Filename, creditData))
 
-	creditTransactions := make([]CreditTransaction, len(credits))
-	for i, credit := range credits {
-		creditTransactions[i] = CreditTransaction{Transaction: credit, Type: "credit"}
+	debitData, err := io.ReadAll(debitFile)
+	if err != nil {
+		http.Error(w, "Error reading debit file", http.StatusBadRequest)
+		return
 	}
+	params.Inputs = append(params.Inputs, hashInput(debitHeader.Filename, debitData))
 
-	debitTransactions := make([]DebitTransaction, len(debits))
-	for i, debit := range debits {
-		debitTransactions[i] = DebitTransaction{Transaction: debit, Type: "debit"}
+	// Statement mode keeps the signs, so bank statement and journal entries
+	// stay on their side
+	options := inputOptions{
+		Options: ingest.Options{Account: r.FormValue("account"), Password: r.FormValue("password"), CSV: ingest.FormDialect(r.FormValue)},
+		Signed:  params.Statement != nil,
+	}
+	if err := options.CSV.Validate(); err != nil {
+		http.Error(w, "Invalid CSV dialect: "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	matchedTransactions, unmatchedCredits, unmatchedDebits := reconcile(creditTransactions, debitTransactions, days, threshold)
-	report := generateReport(matchedTransactions, unmatchedCredits, unmatchedDebits)
-	w.Write([]byte(report))
-}
+	creditInput, err := parseSideInput(creditHeader.Filename, creditData, "credit", options)
+	if err != nil {
+		http.Error(w, "Error parsing credit file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-// Parse CSV file from multipart file
-func parseCSVFile(file multipart.File, transactionType string) ([]Transaction, error) {
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
+	debitInput, err := parseSideInput(debitHeader.Filename, debitData, "debit", options)
+	if err != nil {
+		http.Error(w, "Error parsing debit file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	credits, debits := creditInput.Transactions, debitInput.Transactions
 
-	var transactions []Transaction
-	for {
-		record, err := reader.Read()
+	if configJSON := r.FormValue("quality"); configJSON != "" {
+		config, err := parseQualityConfig([]byte(configJSON))
 		if err != nil {
-			break
+			http.Error(w, "Invalid data quality configuration: "+err.Error(), http.StatusBadRequest)
+			return
 		}
+		report := newQualityReport(config,
+			profileFile(config, creditHeader.Filename, creditInput.Document, "credit", options.Signed),
+			profileFile(config, debitHeader.Filename, debitInput.Document, "debit", options.Signed))
+		if report.Blocked {
+			writeQualityReport(w, negotiateResultFormat(r), http.StatusUnprocessableEntity, report)
+			return
+		}
+	}
 
-		value, err := strconv.ParseFloat(record[2], 64)
-		if err != nil {
-			log.Printf("Error parsing value for transaction %s: %v", record[0], err)
-			continue
+	if params.Statement != nil && r.FormValue("bank_opening") == "" && r.FormValue("bank_closing") == "" {
+		bankStatement := debitInput.Statement
+		if params.Statement.BookSide == "debit" {
+			bankStatement = creditInput.Statement
+		}
+		if err := fillBankBalances(params.Statement, bankStatement); err != nil {
+			http.Error(w, "Invalid statement balances: "+err.Error(), http.StatusBadRequest)
+			return
 		}
+	}
 
-		date, err := time.Parse("1/2/2006", record[1])
+	var matchedTransactions [][]Transaction
+	var unmatchedCredits []CreditTransaction
+	var unmatchedDebits []DebitTransaction
+	if carryForward, _ := strconv.ParseBool(r.FormValue("carry_forward")); carryForward {
+		if openItems == nil {
+			http.Error(w, "No open-items store configured", http.StatusBadRequest)
+			return
+		}
+		period, err := parsePeriod(r.FormValue("period"), params.RunAt)
 		if err != nil {
-			log.Printf("Error parsing date for transaction %s: %v", record[0], err)
-			continue
+			http.Error(w, "Invalid period: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-
-		transaction := Transaction{
-			No:    record[0],
-			Value: value,
-			Date:  date,
+		matchedTransactions, unmatchedCredits, unmatchedDebits, err = openItems.reconcile(period, credits, debits, days, threshold, trace)
+		if err != nil {
+			http.Error(w, "Error carrying forward open items: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
-
-		transactions = append(transactions, transaction)
+	} else {
+		matchedTransactions, unmatchedCredits, unmatchedDebits = reconcileTraced(credits, debits, days, threshold, trace)
+	}
+	if decisionLog != nil {
+		if err := decisionLog.append(params, trace); err != nil {
+			http.Error(w, "Error writing decision log: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	var parameterSweep *sweepResult
+	if runSweep {
+		result := sweep(credits, debits, sweepDays, sweepThresholds)
+		parameterSweep = &result
 	}
 
-	return transactions, nil
+	var rejected []rejectedRow
+	for _, input := range []sideInput{creditInput, debitInput} {
+		rejected = append(append(rejected, input.Rejected...), input.OtherSide...)
+	}
+	writeResult(w, negotiateResultFormat(r), params, matchedTransactions, unmatchedCredits, unmatchedDebits, rejected, parameterSweep)
 }
 
 func main() {
 	// Define command-line flags
-	creditFilePath := flag.String("c", "", "Path to the credit file")
-	debitFilePath := flag.String("d", "", "Path to the debit file")
+	creditFilePath := flag.String("c", "", "Path to the credit file: CSV, JSON, a workbook, a bank statement (OFX, camt.053/054, MT940/942, BAI2) or a journal, told apart by content; only the credit entries of an input tagged by side are read")
+	debitFilePath := flag.String("d", "", "Path to the debit file: CSV, JSON, a workbook, a bank statement (OFX, camt.053/054, MT940/942, BAI2) or a journal, told apart by content; only the debit entries of an input tagged by side are read")
 	days := flag.Int("days", 7, "Number of days to prioritize")
 	threshold := flag.Float64("t", 1000.0, "Threshold value")
+	workbookPath := flag.String("w", "", "Path to a raw workbook, a bank statement, a journal or JSON tagged by side holding both sides, to reconcile instead of -c and -d")
+	stream := flag.Bool("stream", false, "Read both sides from stdin, as JSON records tagged by side or any input -w takes, and write only the JSON result to stdout, with no report or export files; it can't be combined with other inputs or outputs")
+	profilePath := flag.String("profile", "", "Path to a JSON cleaning profile for -w")
+	password := flag.String("password", "", "Password of a protected workbook for -w")
+	annotatePath := flag.String("annotate", "", "Write a copy of the -w workbook annotated with the match results to this file")
+	xlsxPath := flag.String("xlsx", "", "Also write the report as an Excel workbook to this file")
+	htmlPath := flag.String("html", "", "Also write the report as a self-contained HTML page to this file")
+	statement := flag.Bool("statement", false, "Add a bank reconciliation statement to the report")
+	bookSide := flag.String("book-side", "credit", "Side of the input holding the book entries for -statement: credit or debit")
+	bookOpening := flag.Float64("book-opening", 0, "Opening book balance for -statement")
+	bookClosing := flag.Float64("book-closing", 0, "Closing book balance for -statement")
+	bankOpening := flag.Float64("bank-opening", 0, "Opening bank balance for -statement, required unless the bank side is a bank statement carrying it")
+	bankClosing := flag.Float64("bank-closing", 0, "Closing bank balance for -statement, required unless the bank side is a bank statement carrying it")
+	asOf := flag.String("as-of", "", "As-of date (YYYY-MM-DD) of the aging analysis, the run date by default")
+	aging := flag.String("aging", "", "Upper bounds in days of the aging buckets, 30,60,90 by default; -aging or -as-of adds the aging section to the text report")
+	resultPath := flag.String("result", "", "Also save the JSON result to this file, for -diff")
+	diff := flag.Bool("diff", false, "Compare two saved JSON results given as arguments: old.json new.json")
+	runSweep := flag.Bool("sweep", false, "Also reconcile over a grid of windows and thresholds and recommend a combination")
+	sweepDaysFlag := flag.String("sweep-days", "0,1,3,7,14,30,60", "Windows in days of -sweep")
+	sweepThresholdsFlag := flag.String("sweep-t", "0,1,10,100,1000", "Thresholds of -sweep")
+	storePath := flag.String("store", "", "Path to the open-items store; unmatched items are carried into the next run")
+	period := flag.String("period", "", "Period label of the run for -store, YYYY-MM of the run date by default")
+	listOpen := flag.Bool("open-items", false, "List the open items of -store with their age")
+	exportFormat := flag.String("export", exportCSV, "Format of the matched and unmatched transaction files: csv or json")
+	decisionLogPath := flag.String("decision-log", "", "Append the matching decisions of every run to this hash-chained JSON Lines log")
+	verifyLog := flag.String("verify-log", "", "Check the hash chain of a decision log")
+	account := flag.String("account", "", "Account whose postings a beancount or ledger journal given as -c or -d supplies")
+	journalOut := flag.String("journal-out", "", "Write beancount or ledger entries adjusting the residuals of the matched groups to this file, to append to the reconciled journal")
+	writeOffAccount := flag.String("write-off-account", defaultWriteOffAccount, "Offset account of the -journal-out entries")
+	var dialect ingest.Dialect
+	flag.StringVar(&dialect.Delimiter, "csv-delimiter", "", "Field delimiter of CSV inputs, one character or tab; detected by default")
+	flag.StringVar(&dialect.Quote, "csv-quote", "", "Quote character of CSV inputs, \" by default")
+	flag.StringVar(&dialect.Encoding, "csv-encoding", "", "Encoding of CSV inputs: utf-8, utf-16le, utf-16be or windows-1252; detected by default")
+	flag.StringVar(&dialect.Decimal, "csv-decimal", "", "Decimal separator of CSV amounts, . or ,; detected by default")
+	flag.StringVar(&dialect.Thousands, "csv-thousands", "", "Thousands separator of CSV amounts")
+	adjustmentsPath := flag.String("adjustments", "", "Path to a JSON configuration of the -adjustments-out export: format, GL accounts, unmatched items")
+	adjustmentsOut := flag.String("adjustments-out", "", "Write adjusting journal entries for the residuals and selected unmatched items to this file, as CSV, IIF or a template for a general ledger import")
+	quality := flag.Bool("quality", false, "Profile the data quality of the inputs before reconciling")
+	qualityConfigPath := flag.String("quality-config", "", "Path to a JSON configuration of -quality: holidays, outlier fence and the limits that block the reconciliation")
 
 	flag.Parse()
 
+	bankBalancesSet := false
+	var streamConflicts []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "bank-opening", "bank-closing":
+			bankBalancesSet = true
+		// Inputs other than stdin, and outputs other than the JSON result
+		case "c", "d", "w", "xlsx", "html", "result", "journal-out", "adjustments-out", "annotate", "export", "diff", "open-items", "verify-log":
+			streamConflicts = append(streamConflicts, "-"+f.Name)
+		}
+	})
+	// Stream mode only writes the JSON result, to stdout, and never the
+	// export files
+	if *stream && len(streamConflicts) > 0 {
+		log.Fatalf("-stream reads stdin and writes only the JSON result to stdout; it can't be combined with %s", strings.Join(streamConflicts, ", "))
+	}
+
+	if *exportFormat != exportCSV && *exportFormat != exportJSON {
+		log.Fatalf("Unknown export format %q", *exportFormat)
+	}
+
+	if err := dialect.Validate(); err != nil {
+		log.Fatalf("Invalid CSV dialect: %v", err)
+	}
+
+	if *asOf != "" {
+		if _, err := time.Parse(exportDateLayout, *asOf); err != nil {
+			log.Fatalf("Invalid as-of date %q", *asOf)
+		}
+	}
+	if _, err := parsePeriod(*period, time.Now()); err != nil {
+		log.Fatalf("Invalid -period: %v", err)
+	}
+	var agingBuckets []int
+	if *aging != "" {
+		bounds, err := parseAgingBuckets(*aging)
+		if err != nil {
+			log.Fatalf("Invalid aging buckets: %v", err)
+		}
+		agingBuckets = bounds
+	}
+
+	sweepDays, err := parseSweepDays(*sweepDaysFlag)
+	if err != nil {
+		log.Fatalf("Invalid -sweep-days: %v", err)
+	}
+	sweepThresholds, err := parseSweepThresholds(*sweepThresholdsFlag)
+	if err != nil {
+		log.Fatalf("Invalid -sweep-t: %v", err)
+	}
+
+	if *bookSide != "credit" && *bookSide != "debit" {
+		log.Fatalf("Unknown book side %q", *bookSide)
+	}
+
+	var adjustments adjustmentConfig
+	if *adjustmentsOut != "" {
+		adjustments, err = loadAdjustmentConfig(*adjustmentsPath, *adjustmentsOut)
+		if err != nil {
+			log.Fatalf("Invalid adjustment configuration: %v", err)
+		}
+	}
+
+	qualityConfig, err := loadQualityConfig(*qualityConfigPath)
+	if err != nil {
+		log.Fatalf("Invalid data quality configuration: %v", err)
+	}
+
+	if *storePath != "" {
+		openItems = newOpenItemStore(*storePath)
+	}
+
+	if *decisionLogPath != "" {
+		decisionLog = newDecisionLog(*decisionLogPath)
+	}
+
+	if *verifyLog != "" {
+		count, err := verifyDecisionLogFile(*verifyLog)
+		if err != nil {
+			log.Fatalf("Decision log %s failed verification after %d entries: %v", *verifyLog, count, err)
+		}
+		fmt.Printf("Decision log %s verified: %d entries\n", *verifyLog, count)
+	}
+
+	if *listOpen {
+		if openItems == nil {
+			log.Fatalf("-open-items needs -store")
+		}
+		items, err := openItems.list(time.Now())
+		if err != nil {
+			log.Fatalf("Error reading open items: %v", err)
+		}
+		fmt.Print(formatOpenItems(items))
+	}
+
+	if *diff {
+		if flag.NArg() != 2 {
+			log.Fatalf("-diff needs two results: old.json new.json")
+		}
+		oldResult, err := loadResultFile(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Error reading result: %v", err)
+		}
+		newResult, err := loadResultFile(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Error reading result: %v", err)
+		}
+		fmt.Print(formatDiff(diffResults(oldResult, newResult)))
+	}
+
 	// Set up HTTP server
 	r := mux.NewRouter()
 	r.HandleFunc("/upload", uploadHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/pipeline", pipelineHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/open-items", openItemsHandler).Methods("GET")
+	r.HandleFunc("/diff", diffHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/profile", profileHandler).Methods("POST", "OPTIONS")
+
+	// Stdout of a stream run is the result alone, and it ends with the run
+	if !*stream {
+		go func() {
+			log.Fatal(http.ListenAndServe(":8080", r))
+		}()
+	}
 
-	go func() {
-		log.Fatal(http.ListenAndServe(":8080", r))
-	}()
-
-	if *creditFilePath != "" && *debitFilePath != "" {
-		credits, err := readCSV(*creditFilePath, "credit")
+	if *stream || *workbookPath != "" || (*creditFilePath != "" && *debitFilePath != "") {
+		profile, err := loadCleanProfile(*profilePath)
 		if err != nil {
-			log.Fatalf("Error reading credit file: %v", err)
+			log.Fatalf("Error reading cleaning profile: %v", err)
 		}
 
-		debits, err := readCSV(*debitFilePath, "debit")
-		if err != nil {
-			log.Fatalf("Error reading debit file: %v", err)
+		params := runParameters{Days: *days, Threshold: *threshold, RunAt: time.Now(), AsOf: *asOf, AgingBuckets: agingBuckets}
+		if *statement {
+			params.Statement = &statementBalances{
+				BookSide:    *bookSide,
+				BookOpening: *bookOpening,
+				BookClosing: *bookClosing,
+				BankOpening: *bankOpening,
+				BankClosing: *bankClosing,
+			}
+		}
+		if !*stream {
+			inputPaths := []string{*workbookPath}
+			if *workbookPath == "" {
+				inputPaths = []string{*creditFilePath, *debitFilePath}
+			}
+			for _, inputPath := range inputPaths {
+				input, err := hashInputFile(inputPath)
+				if err != nil {
+					log.Fatalf("Error reading input file: %v", err)
+				}
+				params.Inputs = append(params.Inputs, input)
+			}
+		}
+
+		// A workbook, bank statement, journal or tagged JSON given as -w or
+		// on stdin holds both sides
+		var workbook ingest.Document
+		workbookName := *workbookPath
+		if *stream || *workbookPath != "" {
+			var data []byte
+			if *stream {
+				workbookName = "stdin"
+				data, err = io.ReadAll(os.Stdin)
+				params.Inputs = append(params.Inputs, hashInput(workbookName, data))
+			} else {
+				data, err = os.ReadFile(*workbookPath)
+			}
+			if err != nil {
+				log.Fatalf("Error reading input file: %v", err)
+			}
+			workbook, err = ingest.Parse(workbookName, data, ingest.Options{Account: *account, Profile: &profile, Password: *password, CSV: dialect})
+			if err != nil {
+				log.Fatalf("Error reading workbook: %v", err)
+			}
+			for _, entry := range workbook.Entries {
+				if entry.Side == "" {
+					log.Fatalf("Transaction %s of the %s input has no side; give a file holding a single side as -c or -d", entry.Reference, workbook.Format)
+				}
+			}
 		}
 
-		creditTransactions := make([]CreditTransaction, len(credits))
-		for i, credit := range credits {
-			creditTransactions[i] = CreditTransaction{Transaction: credit, Type: "credit"}
+		var trace *decisionTrace
+		if decisionLog != nil {
+			params.RunID = newRunID()
+			trace = newDecisionTrace()
 		}
 
-		debitTransactions := make([]DebitTransaction, len(debits))
-		for i, debit := range debits {
-			debitTransactions[i] = DebitTransaction{Transaction: debit, Type: "debit"}
+		var credits, debits []Transaction
+		var creditInput, debitInput sideInput
+		switch {
+		case *stream || *workbookPath != "":
+			credits, debits = documentTransactions(workbook, "credit", false), documentTransactions(workbook, "debit", false)
+			if workbook.Kind == ingest.KindJournal {
+				creditInput.Journal = &workbook
+			}
+		default:
+			options := inputOptions{
+				Options: ingest.Options{Account: *account, Profile: &profile, Password: *password, CSV: dialect},
+				Signed:  *statement,
+			}
+
+			creditInput, err = readSideFile(*creditFilePath, "credit", options)
+			if err != nil {
+				log.Fatalf("Error reading credit file: %v", err)
+			}
+
+			debitInput, err = readSideFile(*debitFilePath, "debit", options)
+			if err != nil {
+				log.Fatalf("Error reading debit file: %v", err)
+			}
+			credits, debits = creditInput.Transactions, debitInput.Transactions
 		}
 
-		matchedTransactions, unmatchedCredits, unmatchedDebits := reconcile(creditTransactions, debitTransactions, *days, *threshold)
+		// The profile of a stream run goes to stderr with the other messages
+		if *quality || *qualityConfigPath != "" {
+			var files []fileProfile
+			if *stream || *workbookPath != "" {
+				files = append(files, profileFile(qualityConfig, workbookName, workbook, "", false))
+			} else {
+				files = append(files,
+					profileFile(qualityConfig, *creditFilePath, creditInput.Document, "credit", *statement),
+					profileFile(qualityConfig, *debitFilePath, debitInput.Document, "debit", *statement))
+			}
+			report := newQualityReport(qualityConfig, files...)
+			out := os.Stdout
+			if *stream {
+				out = os.Stderr
+			}
+			fmt.Fprintln(out, formatQuality(report))
+			if report.Blocked {
+				log.Fatalf("Reconciliation blocked by %d data quality violations", len(report.Violations))
+			}
+		}
 
-		report := generateReport(matchedTransactions, unmatchedCredits, unmatchedDebits)
+		bankStatement := debitInput.Statement
+		if *bookSide == "debit" {
+			bankStatement = creditInput.Statement
+		}
+		if *statement && !bankBalancesSet {
+			if err := fillBankBalances(params.Statement, bankStatement); err != nil {
+				log.Fatalf("Invalid statement balances: %v", err)
+			}
+		}
+
+		var matchedTransactions [][]Transaction
+		var unmatchedCredits []CreditTransaction
+		var unmatchedDebits []DebitTransaction
+		if openItems != nil {
+			runPeriod, _ := parsePeriod(*period, params.RunAt)
+			matchedTransactions, unmatchedCredits, unmatchedDebits, err = openItems.reconcile(runPeriod, credits, debits, *days, *threshold, trace)
+			if err != nil {
+				log.Fatalf("Error carrying forward open items: %v", err)
+			}
+		} else {
+			matchedTransactions, unmatchedCredits, unmatchedDebits = reconcileTraced(credits, debits, *days, *threshold, trace)
+		}
+		if decisionLog != nil {
+			if err := decisionLog.append(params, trace); err != nil {
+				log.Fatalf("Failed to write decision log: %v", err)
+			}
+			if !*stream {
+				fmt.Printf("Decisions of run %s appended to %s\n", params.RunID, *decisionLogPath)
+			}
+		}
+
+		if *stream {
+			var parameterSweep *sweepResult
+			if *runSweep {
+				result := sweep(credits, debits, sweepDays, sweepThresholds)
+				parameterSweep = &result
+			}
+			if err := writeStreamResult(os.Stdout, params, matchedTransactions, unmatchedCredits, unmatchedDebits, workbook.Rejected, parameterSweep); err != nil {
+				log.Fatalf("Failed to write JSON result: %v", err)
+			}
+			return
+		}
+
+		report := generateRunReport(params, matchedTransactions, unmatchedCredits, unmatchedDebits)
 		fmt.Println(report)
 
-		unmatchedCreditsTransactions := [][]Transaction{convertToTransactions(unmatchedCredits)}
-		unmatchedDebitsTransactions := [][]Transaction{convertToTransactions(unmatchedDebits)}
+		if err := writeExportFiles(*exportFormat, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+			log.Fatalf("Failed to write matched and unmatched transactions: %v", err)
+		}
 
-		matchedFilename := "matched_transactions.csv"
-		unmatchedCreditsFilename := "unmatched_credits.csv"
-		unmatchedDebitsFilename := "unmatched_debits.csv"
+		if *xlsxPath != "" {
+			if err := writeExcelReportFile(*xlsxPath, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+				log.Fatalf("Failed to write Excel report: %v", err)
+			}
+		}
+
+		var parameterSweep *sweepResult
+		if *runSweep {
+			result := sweep(credits, debits, sweepDays, sweepThresholds)
+			parameterSweep = &result
+			fmt.Println(formatSweep(result))
+		}
 
-		if err := writeTransactionsToCSV(matchedFilename, matchedTransactions); err != nil {
-			log.Fatalf("Failed to write matched transactions: %v", err)
+		if *resultPath != "" {
+			if err := writeResultFile(*resultPath, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+				log.Fatalf("Failed to write JSON result: %v", err)
+			}
 		}
-		if err := writeTransactionsToCSV(unmatchedCreditsFilename, unmatchedCreditsTransactions); err != nil {
-			log.Fatalf("Failed to write unmatched credits: %v", err)
+
+		if *journalOut != "" {
+			if err := writeJournalFile(*journalOut, *account, *writeOffAccount, params, matchedTransactions, creditInput.Journal, debitInput.Journal); err != nil {
+				log.Fatalf("Failed to write journal adjustments: %v", err)
+			}
 		}
-		if err := writeTransactionsToCSV(unmatchedDebitsFilename, unmatchedDebitsTransactions); err != nil {
-			log.Fatalf("Failed to write unmatched debits: %v", err)
+
+		if *adjustmentsOut != "" {
+			if err := writeAdjustmentsFile(*adjustmentsOut, adjustments, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+				log.Fatalf("Failed to write adjustments: %v", err)
+			}
+		}
+
+		if *htmlPath != "" {
+			if err := writeHTMLReportFile(*htmlPath, params, matchedTransactions, unmatchedCredits, unmatchedDebits, parameterSweep); err != nil {
+				log.Fatalf("Failed to write HTML report: %v", err)
+			}
+		}
+
+		if *annotatePath != "" && *workbookPath != "" && workbook.Format == "xlsx" {
+			if err := writeAnnotatedWorkbook(*annotatePath, *workbookPath, profile, *password, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+				log.Fatalf("Failed to write annotated workbook: %v", err)
+			}
 		}
 	}
 
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Transaction on a day of January 2024
+func jan(no string, day int, value float64) Transaction {
+	return Transaction{No: no, Value: value, Date: time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// Transaction numbers of matched groups, the debit of a many-to-one group
+// first
+func groupNos(matched [][]Transaction) [][]string {
+	groups := [][]string{}
+	for _, transactions := range matched {
+		var nos []string
+		for _, transaction := range transactions {
+			nos = append(nos, transaction.No)
+		}
+		groups = append(groups, nos)
+	}
+	return groups
+}
+
+func TestReconcileManyToOneKeepsSignsApart(t *testing.T) {
+	// The payment would bring the receipt down to the bank amount
+	credits := []Transaction{jan("PAY", 1, -50), jan("DEP", 2, 400)}
+	debits := []Transaction{jan("K1", 1, 350)}
+
+	matched, unmatchedCredits, unmatchedDebits := reconcileTransactions(credits, debits, 7, 0)
+	if len(matched) != 0 {
+		t.Errorf("matched %v, want nothing", groupNos(matched))
+	}
+	if len(unmatchedCredits) != 2 || len(unmatchedDebits) != 1 {
+		t.Fatalf("unmatched %d credits and %d debits, want 2 and 1", len(unmatchedCredits), len(unmatchedDebits))
+	}
+
+	statement := buildStatement(statementBalances{BookSide: "credit", BookClosing: 350, BankClosing: 350}, matched, unmatchedCredits, unmatchedDebits)
+	if len(statement.OutstandingPayments) != 1 || statement.OutstandingPayments[0].No != "PAY" {
+		t.Errorf("outstanding payments %v, want PAY", statement.OutstandingPayments)
+	}
+	if len(statement.DepositsInTransit) != 1 || statement.DepositsInTransit[0].No != "DEP" {
+		t.Errorf("deposits in transit %v, want DEP", statement.DepositsInTransit)
+	}
+	if len(statement.BankReceipts) != 1 || statement.BankReceipts[0].No != "K1" {
+		t.Errorf("bank receipts %v, want K1", statement.BankReceipts)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		credits, debits  []Transaction
+		days             int
+		threshold        float64
+		want             [][]string
+		unmatchedCredits int
+		unmatchedDebits  int
+	}{
+		{
+			name:    "one to one",
+			credits: []Transaction{jan("C1", 5, 100), jan("C2", 6, 250)},
+			debits:  []Transaction{jan("D1", 6, 250), jan("D2", 9, 100)},
+			days:    7,
+			want:    [][]string{{"C1", "D2"}, {"C2", "D1"}},
+		},
+		{
+			name:             "outside the window",
+			credits:          []Transaction{jan("C1", 20, 100)},
+			debits:           []Transaction{jan("D1", 1, 100)},
+			days:             7,
+			want:             [][]string{},
+			unmatchedCredits: 1,
+			unmatchedDebits:  1,
+		},
+		{
+			name:      "many to one within threshold",
+			credits:   []Transaction{jan("C1", 2, 60), jan("C2", 3, 38)},
+			debits:    []Transaction{jan("D1", 4, 100)},
+			days:      7,
+			threshold: 5,
+			want:      [][]string{{"D1", "C1", "C2"}},
+		},
+		{
+			name:      "negative many to one",
+			credits:   []Transaction{jan("C1", 2, -60), jan("C2", 3, 25), jan("C3", 3, -40)},
+			debits:    []Transaction{jan("D1", 4, -100)},
+			days:      7,
+			threshold: 0,
+			want:      [][]string{{"D1", "C1", "C3"}},
+
+			unmatchedCredits: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			matched, unmatchedCredits, unmatchedDebits := reconcileTransactions(tc.credits, tc.debits, tc.days, tc.threshold)
+			got := groupNos(matched)
+			if len(got) != len(tc.want) {
+				t.Fatalf("matched %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if len(got[i]) != len(tc.want[i]) {
+					t.Fatalf("matched %v, want %v", got, tc.want)
+				}
+				for j := range got[i] {
+					if got[i][j] != tc.want[i][j] {
+						t.Fatalf("matched %v, want %v", got, tc.want)
+					}
+				}
+			}
+			if len(unmatchedCredits) != tc.unmatchedCredits || len(unmatchedDebits) != tc.unmatchedDebits {
+				t.Errorf("unmatched %d credits and %d debits, want %d and %d", len(unmatchedCredits), len(unmatchedDebits), tc.unmatchedCredits, tc.unmatchedDebits)
+			}
+		})
+	}
+}
+
+// The sample files of the repository, at the defaults of the command line:
+// every transaction ends up matched or unmatched, once. Numbers repeat
+// across the sides, so they're counted.
+func TestReconcileSampleFiles(t *testing.T) {
+	credits, err := readSideFile(filepath.Join("..", "credits.csv"), "credit", inputOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	debits, err := readSideFile(filepath.Join("..", "debits.csv"), "debit", inputOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched, unmatchedCredits, unmatchedDebits := reconcileTransactions(credits.Transactions, debits.Transactions, 7, 1000)
+	seen := map[string]int{}
+	for _, transactions := range matched {
+		for _, transaction := range transactions {
+			seen[transaction.No]++
+		}
+	}
+	for _, transaction := range append(convertToTransactions(unmatchedCredits), convertToTransactions(unmatchedDebits)...) {
+		seen[transaction.No]++
+	}
+	for _, transaction := range append(credits.Transactions, debits.Transactions...) {
+		seen[transaction.No]--
+	}
+	for no, count := range seen {
+		if count != 0 {
+			t.Errorf("%s is in the result %d times more than in the input", no, count)
+		}
+	}
+	if len(matched) != 59 || len(unmatchedCredits) != 12 || len(unmatchedDebits) != 2 {
+		t.Errorf("%d groups, %d unmatched credits and %d unmatched debits, want 59, 12 and 2", len(matched), len(unmatchedCredits), len(unmatchedDebits))
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/ingest"
+)
+
+// Version of the JSON result schema. It changes when a field is renamed,
+// removed or changes meaning; new fields can be added within a version.
+const resultSchemaVersion = "1"
+
+// Media types /upload can respond with
+const (
+	mediaText = "text/plain"
+	mediaJSON = "application/json"
+	mediaCSV  = "text/csv"
+	mediaHTML = "text/html"
+	mediaXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// JSON result of a reconciliation run, schema version 1.
+//
+//	schema_version     "1"
+//	summary            counts and totals, see reconSummary
+//	matched_groups     groups in the order reconcile found them
+//	unmatched_credits  credits left over, see resultTransaction
+//	unmatched_debits   debits left over
+//	rejected_rows      input rows that couldn't be read, see rejectedRow
+//	aging              unmatched items by age, see agingAnalysis
+//	parameters         days, threshold, run_at and inputs (name, sha256)
+//	statement          bank reconciliation statement, statement mode only
+//	sweep              parameter sweep, see sweepResult, when one was run
+//
+// Lists are always present, empty rather than null.
+type reconResult struct {
+	SchemaVersion    string              `json:"schema_version"`
+	Summary          reconSummary        `json:"summary"`
+	MatchedGroups    []resultGroup       `json:"matched_groups"`
+	UnmatchedCredits []resultTransaction `json:"unmatched_credits"`
+	UnmatchedDebits  []resultTransaction `json:"unmatched_debits"`
+	RejectedRows     []rejectedRow       `json:"rejected_rows"`
+	Aging            agingAnalysis       `json:"aging"`
+	Parameters       runParameters       `json:"parameters"`
+	Statement        *bankStatement      `json:"statement,omitempty"`
+	Sweep            *sweepResult        `json:"sweep,omitempty"`
+}
+
+// Matched group of the JSON result. ID is the group ID used by the other
+// outputs (G0001, ...), Rule is one-to-one or many-to-one, Residual the
+// amount the group is out by and Confidence a score between 0 and 1.
+type resultGroup struct {
+	ID         string              `json:"id"`
+	Rule       string              `json:"rule"`
+	Residual   float64             `json:"residual"`
+	Confidence float64             `json:"confidence"`
+	Members    []resultTransaction `json:"members"`
+}
+
+// Transaction of the JSON result. Dates are YYYY-MM-DD, Source is the sheet
+// row the cleaner read the transaction from, when known, and Description the
+// narrative of a bank statement entry.
+type resultTransaction struct {
+	Side        string  `json:"side"`
+	No          string  `json:"no"`
+	Date        string  `json:"date"`
+	Amount      float64 `json:"amount"`
+	Source      string  `json:"source,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+// Input row that couldn't be read as a transaction. Line is the 1-based
+// line in the input file and Record the fields as read. Entries of the other
+// side left out of a bank statement, journal or workbook have no line; their
+// record is the source, reference, date and amount of the entry.
+type rejectedRow struct {
+	Side   string   `json:"side"`
+	Line   int      `json:"line"`
+	Record []string `json:"record"`
+	Reason string   `json:"reason"`
+}
+
+// Build the JSON result of a run
+func buildResult(params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, rejected []rejectedRow) reconResult {
+	result := reconResult{
+		SchemaVersion:    resultSchemaVersion,
+		Summary:          summarize(matchedTransactions, unmatchedCredits, unmatchedDebits),
+		MatchedGroups:    []resultGroup{},
+		UnmatchedCredits: resultTransactions(convertToTransactions(unmatchedCredits), "credit"),
+		UnmatchedDebits:  resultTransactions(convertToTransactions(unmatchedDebits), "debit"),
+		RejectedRows:     rejected,
+		Aging:            analyzeAging(params, unmatchedCredits, unmatchedDebits),
+		Parameters:       params,
+	}
+	if result.RejectedRows == nil {
+		result.RejectedRows = []rejectedRow{}
+	}
+	if result.Parameters.Inputs == nil {
+		result.Parameters.Inputs = []inputFile{}
+	}
+	if params.Statement != nil {
+		statement := buildStatement(*params.Statement, matchedTransactions, unmatchedCredits, unmatchedDebits)
+		result.Statement = &statement
+	}
+
+	for i, transactions := range matchedTransactions {
+		group := resultGroup{
+			ID:         matchGroupID(i),
+			Rule:       matchRule(transactions),
+			Residual:   groupResidual(transactions),
+			Confidence: matchConfidence(transactions, params.Days, params.Threshold),
+		}
+		for j, side := range groupSides(transactions) {
+			group.Members = append(group.Members, resultTransaction{
+				Side:        side,
+				No:          transactions[j].No,
+				Date:        transactions[j].Date.Format(exportDateLayout),
+				Amount:      transactions[j].Value,
+				Source:      transactions[j].Source,
+				Description: transactions[j].Description,
+			})
+		}
+		result.MatchedGroups = append(result.MatchedGroups, group)
+	}
+
+	return result
+}
+
+// Transactions of one side in the JSON result
+func resultTransactions(transactions []Transaction, side string) []resultTransaction {
+	result := make([]resultTransaction, len(transactions))
+	for i, transaction := range transactions {
+		result[i] = resultTransaction{
+			Side:        side,
+			No:          transaction.No,
+			Date:        transaction.Date.Format(exportDateLayout),
+			Amount:      transaction.Value,
+			Source:      transaction.Source,
+			Description: transaction.Description,
+		}
+	}
+	return result
+}
+
+// Pick the response format from the Accept header. The media ranges are
+// ranked by their q value and, for equal values, by the order they're
+// listed in. Without a supported type, wildcards included, the response is
+// the plain-text report.
+func negotiateResultFormat(r *http.Request) string {
+	type mediaRange struct {
+		media string
+		q     float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		fields := strings.Split(part, ";")
+		media := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(name) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{media, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, mr := range ranges {
+		switch mr.media {
+		case mediaText, mediaJSON, mediaCSV, mediaHTML, mediaXLSX:
+			return mr.media
+		case "*/*", "text/*":
+			return mediaText
+		}
+	}
+	return mediaText
+}
+
+// Write the JSON result of a stream run, on a single line so it can be piped
+// on. The rows rejected from the input have no side, as it's both of them.
+func writeStreamResult(w io.Writer, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, rejected []ingest.Rejected, sweep *sweepResult) error {
+	rows := []rejectedRow{}
+	for _, row := range rejected {
+		rows = append(rows, rejectedRow{Line: row.Line, Record: row.Record, Reason: row.Reason})
+	}
+	result := buildResult(params, matchedTransactions, unmatchedCredits, unmatchedDebits, rows)
+	result.Sweep = sweep
+	return json.NewEncoder(w).Encode(result)
+}
+
+// Write a reconciliation result in the negotiated format. The parameter
+// sweep, when one was run, is part of the text, JSON and HTML results.
+func writeResult(w http.ResponseWriter, format string, params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction, rejected []rejectedRow, sweep *sweepResult) {
+	w.Header().Add("Vary", "Accept")
+
+	switch format {
+	case mediaJSON:
+		result := buildResult(params, matchedTransactions, unmatchedCredits, unmatchedDebits, rejected)
+		result.Sweep = sweep
+		body, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			http.Error(w, "Error encoding result: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaJSON)
+		w.Write(body)
+
+	case mediaCSV:
+		rows := matchedExportRows(matchedTransactions, params)
+		rows = append(rows, unmatchedExportRows(convertToTransactions(unmatchedCredits), "credit")...)
+		rows = append(rows, unmatchedExportRows(convertToTransactions(unmatchedDebits), "debit")...)
+		buf := new(bytes.Buffer)
+		if err := writeExportCSV(buf, rows); err != nil {
+			http.Error(w, "Error creating CSV: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaCSV)
+		w.Header().Set("Content-Disposition", "attachment; filename=reconciliation.csv")
+		w.Write(buf.Bytes())
+
+	case mediaHTML:
+		buf := new(bytes.Buffer)
+		if err := writeHTMLReport(buf, params, matchedTransactions, unmatchedCredits, unmatchedDebits, rejected, sweep); err != nil {
+			http.Error(w, "Error creating HTML report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=reconciliation.html")
+		w.Write(buf.Bytes())
+
+	case mediaXLSX:
+		buf := new(bytes.Buffer)
+		if err := writeExcelReport(buf, params, matchedTransactions, unmatchedCredits, unmatchedDebits); err != nil {
+			http.Error(w, "Error creating Excel report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaXLSX)
+		w.Header().Set("Content-Disposition", "attachment; filename=reconciliation.xlsx")
+		w.Write(buf.Bytes())
+
+	default:
+		report := generateRunReport(params, matchedTransactions, unmatchedCredits, unmatchedDebits)
+		if sweep != nil {
+			report += "\n" + formatSweep(*sweep)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(report))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateResultFormat(t *testing.T) {
+	for _, tc := range []struct {
+		accept, want string
+	}{
+		{"", mediaText},
+		{"application/json", mediaJSON},
+		{"APPLICATION/JSON", mediaJSON},
+		{"text/html", mediaHTML},
+		{mediaXLSX, mediaXLSX},
+		{"text/html;q=0.5, application/json", mediaJSON},
+		{"application/json;q=0.4, text/csv;q=0.9", mediaCSV},
+		{"application/json; q=0.4 , text/csv ; q=0.9", mediaCSV},
+		{"text/csv, application/json", mediaCSV},
+		{"application/json;q=0.8, text/csv;q=0.8", mediaJSON},
+		{"application/json;q=0, text/csv;q=0.1", mediaCSV},
+		{"application/json;q=0", mediaText},
+		{"*/*", mediaText},
+		{"text/*, application/json;q=0.5", mediaText},
+		{"image/png, */*;q=0.1", mediaText},
+		{"image/png, application/json;q=0.1", mediaJSON},
+		{"application/*", mediaText},
+		{"application/json;q=oops", mediaJSON},
+	} {
+		r := httptest.NewRequest("POST", "/upload", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		if got := negotiateResultFormat(r); got != tc.want {
+			t.Errorf("Accept %q: %s, want %s", tc.accept, got, tc.want)
+		}
+	}
+}
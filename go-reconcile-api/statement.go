@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/ingest"
+)
+
+// Opening and closing balances of both books for statement mode. BookSide
+// is the side of the input holding the book entries, credit or debit; the
+// other side is the bank statement. Amounts keep their sign in statement
+// mode: receipts are positive and payments negative on both sides.
+type statementBalances struct {
+	BookSide    string  `json:"book_side"`
+	BookOpening float64 `json:"book_opening"`
+	BookClosing float64 `json:"book_closing"`
+	BankOpening float64 `json:"bank_opening"`
+	BankClosing float64 `json:"bank_closing"`
+}
+
+// Bank reconciliation statement of a run. The adjusted bank balance adds the
+// book entries the bank hasn't recorded yet to the bank's closing balance;
+// the adjusted book balance adds the bank entries missing from the books and
+// corrects the amounts of matched groups that disagree. Difference is zero
+// when the two books are reconciled.
+type bankStatement struct {
+	BookSide            string              `json:"book_side"`
+	BookRollForward     rollForward         `json:"book_roll_forward"`
+	BankRollForward     rollForward         `json:"bank_roll_forward"`
+	DepositsInTransit   []resultTransaction `json:"deposits_in_transit"`
+	OutstandingPayments []resultTransaction `json:"outstanding_payments"`
+	BankReceipts        []resultTransaction `json:"bank_receipts"`
+	BankCharges         []resultTransaction `json:"bank_charges"`
+	Errors              []statementError    `json:"errors"`
+	AdjustedBankBalance float64             `json:"adjusted_bank_balance"`
+	AdjustedBookBalance float64             `json:"adjusted_book_balance"`
+	Difference          float64             `json:"difference"`
+}
+
+// Movement of one book over the period. Unexplained is the part of the
+// closing balance its entries don't account for.
+type rollForward struct {
+	Opening     float64 `json:"opening"`
+	Movements   float64 `json:"movements"`
+	Closing     float64 `json:"closing"`
+	Unexplained float64 `json:"unexplained"`
+}
+
+// Matched group whose book and bank amounts differ. Difference is the bank
+// amount less the book amount, the correction the books need.
+type statementError struct {
+	GroupID    string  `json:"group_id"`
+	Book       float64 `json:"book"`
+	Bank       float64 `json:"bank"`
+	Difference float64 `json:"difference"`
+}
+
+// Round an amount to cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Build the bank reconciliation statement of a run
+func buildStatement(balances statementBalances, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) bankStatement {
+	bookSide, bankSide := "credit", "debit"
+	bookItems, bankItems := convertToTransactions(unmatchedCredits), convertToTransactions(unmatchedDebits)
+	if balances.BookSide == "debit" {
+		bookSide, bankSide = bankSide, bookSide
+		bookItems, bankItems = bankItems, bookItems
+	}
+
+	statement := bankStatement{
+		BookSide:            bookSide,
+		DepositsInTransit:   []resultTransaction{},
+		OutstandingPayments: []resultTransaction{},
+		BankReceipts:        []resultTransaction{},
+		BankCharges:         []resultTransaction{},
+		Errors:              []statementError{},
+	}
+
+	var bookMovements, bankMovements float64
+
+	// Book entries the bank hasn't recorded adjust the bank balance
+	adjustedBank := balances.BankClosing
+	for _, item := range resultTransactions(bookItems, bookSide) {
+		bookMovements += item.Amount
+		adjustedBank += item.Amount
+		if item.Amount >= 0 {
+			statement.DepositsInTransit = append(statement.DepositsInTransit, item)
+		} else {
+			statement.OutstandingPayments = append(statement.OutstandingPayments, item)
+		}
+	}
+
+	// Bank entries missing from the books adjust the book balance
+	adjustedBook := balances.BookClosing
+	for _, item := range resultTransactions(bankItems, bankSide) {
+		bankMovements += item.Amount
+		adjustedBook += item.Amount
+		if item.Amount >= 0 {
+			statement.BankReceipts = append(statement.BankReceipts, item)
+		} else {
+			statement.BankCharges = append(statement.BankCharges, item)
+		}
+	}
+
+	for i, transactions := range matchedTransactions {
+		var book, bank float64
+		for j, side := range groupSides(transactions) {
+			if side == bookSide {
+				book += transactions[j].Value
+			} else {
+				bank += transactions[j].Value
+			}
+		}
+		bookMovements += book
+		bankMovements += bank
+
+		if difference := roundCents(bank - book); difference != 0 {
+			adjustedBook += difference
+			statement.Errors = append(statement.Errors, statementError{
+				GroupID:    matchGroupID(i),
+				Book:       roundCents(book),
+				Bank:       roundCents(bank),
+				Difference: difference,
+			})
+		}
+	}
+
+	statement.BookRollForward = newRollForward(balances.BookOpening, bookMovements, balances.BookClosing)
+	statement.BankRollForward = newRollForward(balances.BankOpening, bankMovements, balances.BankClosing)
+	statement.AdjustedBankBalance = roundCents(adjustedBank)
+	statement.AdjustedBookBalance = roundCents(adjustedBook)
+	statement.Difference = roundCents(adjustedBank - adjustedBook)
+
+	return statement
+}
+
+// Roll a book forward from its opening balance by its movements
+func newRollForward(opening, movements, closing float64) rollForward {
+	return rollForward{
+		Opening:     opening,
+		Movements:   roundCents(movements),
+		Closing:     closing,
+		Unexplained: roundCents(closing - opening - movements),
+	}
+}
+
+// Text report of a run, with the aging of its unmatched items when an as-of
+// date or aging buckets were asked for, ending with the bank reconciliation
+// statement in statement mode
+func generateRunReport(params runParameters, matchedTransactions [][]Transaction, unmatchedCredits []CreditTransaction, unmatchedDebits []DebitTransaction) string {
+	report := generateReport(matchedTransactions, unmatchedCredits, unmatchedDebits)
+	if params.AsOf != "" || len(params.AgingBuckets) > 0 {
+		report += "\n" + formatAging(analyzeAging(params, unmatchedCredits, unmatchedDebits))
+	}
+	if params.Statement != nil {
+		report += "\n" + formatStatement(buildStatement(*params.Statement, matchedTransactions, unmatchedCredits, unmatchedDebits))
+	}
+	return report
+}
+
+// Format the statement as text for the plain-text report
+func formatStatement(statement bankStatement) string {
+	var b strings.Builder
+	line := func(label string, amount float64) {
+		fmt.Fprintf(&b, "%-44s %16s\n", label, formatMoney(amount))
+	}
+	items := func(label string, items []resultTransaction) {
+		var total float64
+		for _, item := range items {
+			total += item.Amount
+		}
+		line(fmt.Sprintf("%s (%d)", label, len(items)), roundCents(total))
+		for _, item := range items {
+			fmt.Fprintf(&b, "    %-20s %-12s %14s\n", item.No, item.Date, formatMoney(item.Amount))
+		}
+	}
+
+	bankSide := "debit"
+	if statement.BookSide == "debit" {
+		bankSide = "credit"
+	}
+
+	b.WriteString("Bank Reconciliation Statement\n")
+	fmt.Fprintf(&b, "Book: %s file, bank: %s file\n\n", statement.BookSide, bankSide)
+
+	fmt.Fprintf(&b, "%-28s %16s %16s\n", "Roll-forward", "Book", "Bank")
+	book, bank := statement.BookRollForward, statement.BankRollForward
+	for _, row := range []struct {
+		label      string
+		book, bank float64
+	}{
+		{"Opening balance", book.Opening, bank.Opening},
+		{"Movements", book.Movements, bank.Movements},
+		{"Closing balance", book.Closing, bank.Closing},
+		{"Unexplained movement", book.Unexplained, bank.Unexplained},
+	} {
+		fmt.Fprintf(&b, "%-28s %16s %16s\n", row.label, formatMoney(row.book), formatMoney(row.bank))
+	}
+	b.WriteString("\n")
+
+	line("Balance per bank statement", statement.BankRollForward.Closing)
+	items("Add: deposits in transit", statement.DepositsInTransit)
+	items("Less: outstanding payments", statement.OutstandingPayments)
+	line("Adjusted bank balance", statement.AdjustedBankBalance)
+	b.WriteString("\n")
+
+	line("Balance per books", statement.BookRollForward.Closing)
+	items("Add: bank-only receipts", statement.BankReceipts)
+	items("Less: bank-only charges", statement.BankCharges)
+	var errorTotal float64
+	for _, statementError := range statement.Errors {
+		errorTotal += statementError.Difference
+	}
+	line(fmt.Sprintf("Add/less: errors (%d)", len(statement.Errors)), roundCents(errorTotal))
+	for _, statementError := range statement.Errors {
+		fmt.Fprintf(&b, "    %-20s book %12s, bank %12s %14s\n", statementError.GroupID, formatMoney(statementError.Book), formatMoney(statementError.Bank), formatMoney(statementError.Difference))
+	}
+	line("Adjusted book balance", statement.AdjustedBookBalance)
+	b.WriteString("\n")
+
+	line("Difference", statement.Difference)
+	if statement.Difference != 0 {
+		b.WriteString("The books do not reconcile.\n")
+	}
+
+	return b.String()
+}
+
+// Read the statement balances of an /upload request. Statement mode is off,
+// and the balances nil, when none of the balance fields are set. The bank
+// balances may be left out when the bank file is a bank statement carrying
+// them, see fillBankBalances.
+func parseStatementForm(r *http.Request) (*statementBalances, error) {
+	fields := []string{"book_opening", "book_closing", "bank_opening", "bank_closing"}
+
+	set := false
+	for _, field := range fields {
+		if r.FormValue(field) != "" {
+			set = true
+		}
+	}
+	if !set {
+		return nil, nil
+	}
+
+	balances := &statementBalances{BookSide: "credit"}
+	if side := r.FormValue("book_side"); side != "" {
+		if side != "credit" && side != "debit" {
+			return nil, fmt.Errorf("invalid book_side %q", side)
+		}
+		balances.BookSide = side
+	}
+
+	values := []*float64{&balances.BookOpening, &balances.BookClosing, &balances.BankOpening, &balances.BankClosing}
+	for i, field := range fields {
+		if r.FormValue(field) == "" && strings.HasPrefix(field, "bank_") {
+			continue
+		}
+		value, err := strconv.ParseFloat(r.FormValue(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value", field)
+		}
+		*values[i] = value
+	}
+
+	return balances, nil
+}
+
+// Take the bank balances of statement mode from the imported statement of
+// the bank side, for balances that weren't given
+func fillBankBalances(balances *statementBalances, bankStatement *ingest.Document) error {
+	if bankStatement == nil {
+		return fmt.Errorf("bank balances are required unless the bank file is a bank statement carrying them")
+	}
+	opening, closing, ok := bankStatement.Balances()
+	if !ok {
+		return fmt.Errorf("the %s statement has no closing balance", bankStatement.Format)
+	}
+	balances.BankOpening, balances.BankClosing = opening, closing
+	return nil
+}
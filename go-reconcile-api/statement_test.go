@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateRunReportAgingOnRequest(t *testing.T) {
+	unmatchedCredits := []CreditTransaction{{Transaction: jan("C1", 5, 100)}}
+	runAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name   string
+		params runParameters
+		aging  bool
+	}{
+		{name: "plain", params: runParameters{RunAt: runAt}},
+		{name: "as of", params: runParameters{RunAt: runAt, AsOf: "2024-02-01"}, aging: true},
+		{name: "buckets", params: runParameters{RunAt: runAt, AgingBuckets: []int{15, 45}}, aging: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := generateRunReport(tc.params, nil, unmatchedCredits, nil)
+			if !strings.HasPrefix(report, generateReport(nil, unmatchedCredits, nil)) {
+				t.Errorf("report does not start with the plain report:\n%s", report)
+			}
+			if got := strings.Contains(report, "Aging of Unmatched Transactions"); got != tc.aging {
+				t.Errorf("aging section %v, want %v:\n%s", got, tc.aging, report)
+			}
+		})
+	}
+}
+
+func TestBuildStatementAfterFailedManyToOne(t *testing.T) {
+	// The credits don't add up to the debit, so they stay open on both sides
+	credits := []Transaction{jan("C1", 2, 100), jan("C2", 3, 200)}
+	debits := []Transaction{jan("D1", 4, 1000)}
+
+	matched, unmatchedCredits, unmatchedDebits := reconcileTransactions(credits, debits, 7, 0)
+	if len(matched) != 0 || len(unmatchedCredits) != 2 || len(unmatchedDebits) != 1 {
+		t.Fatalf("matched %v with %d credits and %d debits unmatched, want nothing matched, 2 and 1", groupNos(matched), len(unmatchedCredits), len(unmatchedDebits))
+	}
+
+	statement := buildStatement(statementBalances{BookSide: "credit", BookClosing: 300, BankClosing: 1000}, matched, unmatchedCredits, unmatchedDebits)
+	if len(statement.DepositsInTransit) != 2 || len(statement.BankReceipts) != 1 {
+		t.Errorf("%d deposits in transit and %d bank receipts, want 2 and 1", len(statement.DepositsInTransit), len(statement.BankReceipts))
+	}
+	if statement.AdjustedBankBalance != 1300 || statement.AdjustedBookBalance != 1300 || statement.Difference != 0 {
+		t.Errorf("adjusted bank %.2f, book %.2f, difference %.2f; want 1300, 1300 and 0", statement.AdjustedBankBalance, statement.AdjustedBookBalance, statement.Difference)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Default grid of the parameter sweep
+var (
+	defaultSweepDays       = []int{0, 1, 3, 7, 14, 30, 60}
+	defaultSweepThresholds = []float64{0, 1, 10, 100, 1000}
+)
+
+// Outcome of reconcile over a grid of windows and thresholds. Recommended is
+// the index in Points of the recommended combination.
+type sweepResult struct {
+	Days        []int        `json:"days"`
+	Thresholds  []float64    `json:"thresholds"`
+	Points      []sweepPoint `json:"points"`
+	Recommended int          `json:"recommended"`
+}
+
+// One combination of the sweep. Clean matches are the transactions of groups
+// without a residual, ResidualTotal the sum of the absolute residuals.
+type sweepPoint struct {
+	Days                int     `json:"days"`
+	Threshold           float64 `json:"threshold"`
+	CreditMatchRate     float64 `json:"credit_match_rate"`
+	DebitMatchRate      float64 `json:"debit_match_rate"`
+	MatchedGroups       int     `json:"matched_groups"`
+	ManyToOneGroups     int     `json:"many_to_one_groups"`
+	ResidualTotal       float64 `json:"residual_total"`
+	MatchedTransactions int     `json:"matched_transactions"`
+	CleanMatches        int     `json:"clean_matches"`
+}
+
+// Parse a comma-separated list of windows in days
+func parseSweepDays(value string) ([]int, error) {
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		d, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid window %q", part)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// Parse a comma-separated list of thresholds
+func parseSweepThresholds(value string) ([]float64, error) {
+	var thresholds []float64
+	for _, part := range strings.Split(value, ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid threshold %q", part)
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+// Reconcile the transactions with every combination of window and threshold.
+// The recommendation is the combination with the most clean matches, the
+// narrowest window and smallest threshold first: past it, more tolerance
+// only buys matches with residuals.
+func sweep(credits []Transaction, debits []Transaction, days []int, thresholds []float64) sweepResult {
+	days, thresholds = slices.Clone(days), slices.Clone(thresholds)
+	slices.Sort(days)
+	slices.Sort(thresholds)
+	result := sweepResult{Days: days, Thresholds: thresholds}
+
+	for _, d := range days {
+		for _, t := range thresholds {
+			matchedTransactions, unmatchedCredits, unmatchedDebits := reconcileTransactions(credits, debits, d, t)
+			summary := summarize(matchedTransactions, unmatchedCredits, unmatchedDebits)
+
+			point := sweepPoint{
+				Days:                d,
+				Threshold:           t,
+				CreditMatchRate:     summary.CreditMatchRate,
+				DebitMatchRate:      summary.DebitMatchRate,
+				MatchedGroups:       summary.MatchedGroups,
+				ManyToOneGroups:     summary.ManyToOneGroups,
+				MatchedTransactions: summary.MatchedCredits + summary.MatchedDebits,
+			}
+			for _, transactions := range matchedTransactions {
+				residual := groupResidual(transactions)
+				if residual == 0 {
+					point.CleanMatches += len(transactions)
+				} else if residual < 0 {
+					point.ResidualTotal -= residual
+				} else {
+					point.ResidualTotal += residual
+				}
+			}
+			point.ResidualTotal = roundCents(point.ResidualTotal)
+
+			if len(result.Points) > 0 && point.CleanMatches > result.Points[result.Recommended].CleanMatches {
+				result.Recommended = len(result.Points)
+			}
+			result.Points = append(result.Points, point)
+		}
+	}
+
+	return result
+}
+
+// Format the sweep as a text table
+func formatSweep(result sweepResult) string {
+	var b strings.Builder
+	b.WriteString("Parameter Sweep:\n")
+	fmt.Fprintf(&b, "%6s %12s %10s %10s %8s %12s %14s %8s %8s\n", "Days", "Threshold", "Credits %", "Debits %", "Groups", "Many-to-one", "Residuals", "Matched", "Clean")
+	for i, point := range result.Points {
+		marker := ""
+		if i == result.Recommended {
+			marker = " <- recommended"
+		}
+		fmt.Fprintf(&b, "%6d %12s %10s %10s %8d %12d %14s %8d %8d%s\n", point.Days, formatMoney(point.Threshold), formatPercent(point.CreditMatchRate), formatPercent(point.DebitMatchRate), point.MatchedGroups, point.ManyToOneGroups, formatMoney(point.ResidualTotal), point.MatchedTransactions, point.CleanMatches, marker)
+	}
+	if len(result.Points) > 0 {
+		best := result.Points[result.Recommended]
+		fmt.Fprintf(&b, "Recommended: -days %d -t %s\n", best.Days, strconv.FormatFloat(best.Threshold, 'f', -1, 64))
+	}
+	return b.String()
+}
+
+// Colors of the series of the sweep chart
+var chartColors = []string{"#4CAF50", "#2196F3", "#FF9800", "#9C27B0", "#F44336", "#009688", "#795548", "#607D8B"}
+
+// Line chart of a sweep by threshold, drawn as inline SVG. Each window has a
+// solid line of its matched transactions and a dashed one of its clean
+// matches; the gap between them is what the tolerance buys.
+type sweepChart struct {
+	Width, Height int
+	Left, Bottom  int
+	Series        []chartSeries
+	XLabels       []chartLabel
+	YLabels       []chartLabel
+	Recommended   chartLabel
+}
+
+// Lines of one window of the sweep chart, as SVG polyline coordinates
+type chartSeries struct {
+	Label       string
+	Color       string
+	Points      string
+	CleanPoints string
+}
+
+// Label of a chart axis, or a marked point, at X, Y
+type chartLabel struct {
+	X, Y float64
+	Text string
+}
+
+// Lay out the sweep chart
+func newSweepChart(result sweepResult) sweepChart {
+	chart := sweepChart{Width: 640, Height: 280, Left: 50, Bottom: 250}
+	plotWidth, plotHeight := float64(chart.Width-chart.Left-20), float64(chart.Bottom-20)
+
+	maxMatched := 1
+	for _, point := range result.Points {
+		maxMatched = max(maxMatched, point.MatchedTransactions)
+	}
+
+	x := func(i int) float64 {
+		if len(result.Thresholds) < 2 {
+			return float64(chart.Left) + plotWidth/2
+		}
+		return float64(chart.Left) + plotWidth*float64(i)/float64(len(result.Thresholds)-1)
+	}
+	y := func(count int) float64 {
+		return float64(chart.Bottom) - plotHeight*float64(count)/float64(maxMatched)
+	}
+
+	for i, t := range result.Thresholds {
+		chart.XLabels = append(chart.XLabels, chartLabel{X: x(i), Y: float64(chart.Bottom + 18), Text: strconv.FormatFloat(t, 'f', -1, 64)})
+	}
+	for _, count := range []int{0, maxMatched / 2, maxMatched} {
+		chart.YLabels = append(chart.YLabels, chartLabel{X: float64(chart.Left - 8), Y: y(count) + 4, Text: strconv.Itoa(count)})
+	}
+
+	for i, d := range result.Days {
+		series := chartSeries{Label: fmt.Sprintf("%d days", d), Color: chartColors[i%len(chartColors)]}
+		var points, cleanPoints []string
+		for j := range result.Thresholds {
+			point := result.Points[i*len(result.Thresholds)+j]
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(j), y(point.MatchedTransactions)))
+			cleanPoints = append(cleanPoints, fmt.Sprintf("%.1f,%.1f", x(j), y(point.CleanMatches)))
+		}
+		series.Points = strings.Join(points, " ")
+		series.CleanPoints = strings.Join(cleanPoints, " ")
+		chart.Series = append(chart.Series, series)
+	}
+
+	if len(result.Points) > 0 {
+		best := result.Recommended
+		chart.Recommended = chartLabel{
+			X:    x(best % len(result.Thresholds)),
+			Y:    y(result.Points[best].MatchedTransactions),
+			Text: fmt.Sprintf("%d days, threshold %s", result.Points[best].Days, formatMoney(result.Points[best].Threshold)),
+		}
+	}
+
+	return chart
+}
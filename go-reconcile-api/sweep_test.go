@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSweepGrid(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		days  []int
+		err   bool
+	}{
+		{value: "0,7, 30", days: []int{0, 7, 30}},
+		{value: "14", days: []int{14}},
+		{value: "7,-1", err: true},
+		{value: "7,,14", err: true},
+		{value: "1.5", err: true},
+	} {
+		days, err := parseSweepDays(tc.value)
+		if (err != nil) != tc.err || !tc.err && !reflect.DeepEqual(days, tc.days) {
+			t.Errorf("parseSweepDays(%q) = %v, %v; want %v, error %v", tc.value, days, err, tc.days, tc.err)
+		}
+	}
+
+	for _, tc := range []struct {
+		value      string
+		thresholds []float64
+		err        bool
+	}{
+		{value: "0, 0.5,100", thresholds: []float64{0, 0.5, 100}},
+		{value: "-1", err: true},
+		{value: "ten", err: true},
+		{value: "", err: true},
+	} {
+		thresholds, err := parseSweepThresholds(tc.value)
+		if (err != nil) != tc.err || !tc.err && !reflect.DeepEqual(thresholds, tc.thresholds) {
+			t.Errorf("parseSweepThresholds(%q) = %v, %v; want %v, error %v", tc.value, thresholds, err, tc.thresholds, tc.err)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	// C1 needs a week, C2 and C3 a threshold of 2 to cover D2
+	credits := []Transaction{jan("C1", 12, 100), jan("C2", 10, 120), jan("C3", 10, 78)}
+	debits := []Transaction{jan("D1", 5, 100), jan("D2", 11, 200)}
+
+	result := sweep(credits, debits, []int{7, 0}, []float64{5, 0})
+	if !reflect.DeepEqual(result.Days, []int{0, 7}) || !reflect.DeepEqual(result.Thresholds, []float64{0, 5}) {
+		t.Fatalf("grid %v by %v, want it sorted", result.Days, result.Thresholds)
+	}
+
+	for _, tc := range []struct {
+		days      int
+		threshold float64
+		matched   int
+		clean     int
+		residuals float64
+	}{
+		{days: 0, threshold: 0, matched: 0},
+		{days: 0, threshold: 5, matched: 3, residuals: 2},
+		{days: 7, threshold: 0, matched: 2, clean: 2},
+		{days: 7, threshold: 5, matched: 5, clean: 2, residuals: 2},
+	} {
+		var point *sweepPoint
+		for i := range result.Points {
+			if result.Points[i].Days == tc.days && result.Points[i].Threshold == tc.threshold {
+				point = &result.Points[i]
+			}
+		}
+		if point == nil {
+			t.Fatalf("no point for %d days and threshold %v", tc.days, tc.threshold)
+		}
+		if point.MatchedTransactions != tc.matched || point.CleanMatches != tc.clean || point.ResidualTotal != tc.residuals {
+			t.Errorf("%d days, threshold %v: %d matched, %d clean, residuals %v; want %d, %d, %v", tc.days, tc.threshold, point.MatchedTransactions, point.CleanMatches, point.ResidualTotal, tc.matched, tc.clean, tc.residuals)
+		}
+	}
+
+	// The first point with the most clean matches: the narrowest window,
+	// then the smallest threshold
+	if best := result.Points[result.Recommended]; best.Days != 7 || best.Threshold != 0 {
+		t.Errorf("recommended %d days and threshold %v, want 7 and 0", best.Days, best.Threshold)
+	}
+}
+
+func TestUploadHandlerChecksSweepBeforeLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	decisionLog = newDecisionLog(path)
+	t.Cleanup(func() { decisionLog = nil })
+
+	files := []formFile{
+		{"creditFile", "credits.csv", []byte("C1,1/5/2024,100\n")},
+		{"debitFile", "debits.csv", []byte("D1,1/5/2024,100\n")},
+	}
+	for _, field := range []string{"sweep_days", "sweep_thresholds"} {
+		rec := postForm(t, uploadHandler, files, map[string]string{"days": "7", "threshold": "0", "sweep": "true", field: "-1"})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s -1: status %d, want %d", field, rec.Code, http.StatusBadRequest)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s -1: the decision log was written", field)
+		}
+	}
+
+	rec := postForm(t, uploadHandler, files, map[string]string{"days": "7", "threshold": "0", "sweep": "true", "sweep_days": "0,7"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if count, err := verifyDecisionLogFile(path); err != nil || count == 0 {
+		t.Errorf("verified %d entries, error %v, want the run logged", count, err)
+	}
+}
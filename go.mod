@@ -2,12 +2,15 @@ module github.com/gin-gonic/gin
 
 go 1.22.1
 
-require github.com/xuri/excelize/v2 v2.8.1
+require (
+	github.com/gorilla/handlers v1.5.2
+	github.com/gorilla/mux v1.8.1
+	github.com/xuri/excelize/v2 v2.8.1
+	golang.org/x/text v0.14.0
+)
 
 require (
 	github.com/felixge/httpsnoop v1.0.4 // indirect
-	github.com/gorilla/handlers v1.5.2 // indirect
-	github.com/gorilla/mux v1.8.1 // indirect
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
 	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.3 // indirect
@@ -15,5 +18,4 @@ require (
 	github.com/xuri/nfp v0.0.0-20230919160717-d98342af3f05 // indirect
 	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,300 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record of a BAI2 file with its continuation records folded in. Number is
+// the position of the record in the file, counting from 1, and Count the
+// physical records it spans.
+type bai2Record struct {
+	Type   string
+	Fields []string
+	Number int
+	Count  int
+}
+
+// Balance type codes of account identifier records
+const (
+	bai2OpeningLedger = "010"
+	bai2ClosingLedger = "015"
+)
+
+// BAI2 cash management balance reports
+var bai2Format = format{name: "bai2", detect: isBAI2, parse: func(r io.Reader, _ Options) (Document, error) {
+	return parseBAI2(r)
+}}
+
+// Whether a file is a BAI2 file, by its file header
+func isBAI2(_ string, head []byte) bool {
+	head = bytes.TrimLeft(head[:min(len(head), 1024)], "\ufeff \r\n\t")
+	return bytes.HasPrefix(head, []byte("01,")) && bytes.Contains(head, []byte("\n02,"))
+}
+
+// Read the records of a BAI2 file. A record ends with a slash, except that
+// the text of a transaction detail runs to the end of the line; an 88
+// record continues the fields of the one before.
+func readBAI2Records(r io.Reader) ([]bai2Record, error) {
+	var records []bai2Record
+
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			number--
+			continue
+		}
+		line = strings.TrimSuffix(line, "/")
+		fields := strings.Split(line, ",")
+
+		if fields[0] == "88" {
+			if len(records) == 0 {
+				return nil, fmt.Errorf("record %d: continuation without a record", number)
+			}
+			last := &records[len(records)-1]
+			last.Fields = append(last.Fields, fields[1:]...)
+			last.Count++
+			continue
+		}
+		records = append(records, bai2Record{Type: fields[0], Fields: fields[1:], Number: number, Count: 1})
+	}
+	return records, scanner.Err()
+}
+
+// Parse a BAI2 amount in cents, without a decimal point. Empty amounts are
+// zero.
+func parseBAI2Amount(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	cents, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return cents, nil
+}
+
+// Number of fields the funds type at fields[0] takes, itself included
+func bai2FundsFields(fields []string) (int, error) {
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	switch fields[0] {
+	case "", "Z", "0", "1", "2":
+		return 1, nil
+	case "V":
+		return 3, nil
+	case "S":
+		return 4, nil
+	case "D":
+		if len(fields) < 2 {
+			return 0, fmt.Errorf("distributed availability without a count")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid distribution count %q", fields[1])
+		}
+		return 2 + 2*n, nil
+	}
+	return 0, fmt.Errorf("invalid funds type %q", fields[0])
+}
+
+// Side of a detail type code: 100-399 are credits and 400-699 debits
+func bai2Side(typeCode string) (string, error) {
+	code, err := strconv.Atoi(typeCode)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("invalid type code %q", typeCode)
+	case code >= 100 && code <= 399:
+		return Credit, nil
+	case code >= 400 && code <= 699:
+		return Debit, nil
+	}
+	return "", fmt.Errorf("type code %s is neither a credit nor a debit", typeCode)
+}
+
+// Parse a BAI2 file. Transaction details (16) become entries dated by the
+// as-of date of their group, referenced by the bank reference, or the
+// customer reference when there's none, with their text as description and
+// their record number as source. The control totals and record counts of
+// every account (49), group (98) and the file (99) are checked. The
+// balances are the opening and closing ledger balances (010, 015) when the
+// file holds a single account.
+func parseBAI2(r io.Reader) (Document, error) {
+	statement := Document{Format: "bai2", Kind: KindStatement}
+
+	records, err := readBAI2Records(r)
+	if err != nil {
+		return statement, err
+	}
+	if len(records) == 0 || records[0].Type != "01" {
+		return statement, fmt.Errorf("no file header")
+	}
+
+	var asOf time.Time
+	var accounts int
+	var opening, closing *float64
+	var fileTotal, groupTotal, accountTotal int64
+	var fileRecords, groupRecords, accountRecords, groups, groupAccounts int
+
+	for _, record := range records {
+		fileRecords += record.Count
+		groupRecords += record.Count
+		accountRecords += record.Count
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("record %d (%s): %s", record.Number, record.Type, fmt.Sprintf(format, args...))
+		}
+		field := func(i int) string {
+			if i < len(record.Fields) {
+				return strings.TrimSpace(record.Fields[i])
+			}
+			return ""
+		}
+
+		switch record.Type {
+		case "01":
+			if fileRecords != 1 {
+				return statement, fail("file header inside the file")
+			}
+
+		case "02":
+			groupRecords, groupTotal, groupAccounts = record.Count, 0, 0
+			asOf, err = time.Parse("060102", field(3))
+			if err != nil {
+				return statement, fail("invalid as-of date %q", field(3))
+			}
+			if statement.Currency == "" {
+				statement.Currency = field(5)
+			}
+
+		case "03":
+			accountRecords, accountTotal = record.Count, 0
+			accounts++
+			groupAccounts++
+			if statement.Account == "" {
+				statement.Account = field(0)
+			}
+			// Summary and status items: type code, amount, item count, funds type
+			for i := 2; i < len(record.Fields) && field(i) != ""; {
+				amount, err := parseBAI2Amount(field(i + 1))
+				if err != nil {
+					return statement, fail("%v", err)
+				}
+				accountTotal += amount
+				balance := float64(amount) / 100
+				switch field(i) {
+				case bai2OpeningLedger:
+					opening = &balance
+				case bai2ClosingLedger:
+					closing = &balance
+				}
+				n, err := bai2FundsFields(record.Fields[min(i+3, len(record.Fields)):])
+				if err != nil {
+					return statement, fail("%v", err)
+				}
+				i += 3 + n
+			}
+
+		case "16":
+			side, err := bai2Side(field(0))
+			if err != nil {
+				return statement, fail("%v", err)
+			}
+			amount, err := parseBAI2Amount(field(1))
+			if err != nil {
+				return statement, fail("%v", err)
+			}
+			accountTotal += amount
+			n, err := bai2FundsFields(record.Fields[min(2, len(record.Fields)):])
+			if err != nil {
+				return statement, fail("%v", err)
+			}
+			next := 2 + n
+			reference := field(next)
+			if reference == "" {
+				reference = field(next + 1)
+			}
+			if reference == "" {
+				reference = fmt.Sprintf("BAI2-%d", record.Number)
+			}
+			var text string
+			if next+2 < len(record.Fields) {
+				text = strings.TrimSpace(strings.Join(record.Fields[next+2:], ","))
+			}
+
+			value := float64(amount) / 100
+			if side == Debit {
+				value = -value
+			}
+			statement.Entries = append(statement.Entries, Entry{
+				Reference:   reference,
+				Date:        asOf,
+				Amount:      value,
+				Side:        side,
+				Description: text,
+				Source:      fmt.Sprintf("record %d", record.Number),
+			})
+
+		case "49":
+			total, err := parseBAI2Amount(field(0))
+			if err != nil {
+				return statement, fail("%v", err)
+			}
+			if total != accountTotal {
+				return statement, fail("account control total %d, records add up to %d", total, accountTotal)
+			}
+			if count, _ := strconv.Atoi(field(1)); count != accountRecords {
+				return statement, fail("account record count %s, found %d", field(1), accountRecords)
+			}
+			groupTotal += accountTotal
+
+		case "98":
+			total, err := parseBAI2Amount(field(0))
+			if err != nil {
+				return statement, fail("%v", err)
+			}
+			if total != groupTotal {
+				return statement, fail("group control total %d, accounts add up to %d", total, groupTotal)
+			}
+			if count, _ := strconv.Atoi(field(1)); count != groupAccounts {
+				return statement, fail("group account count %s, found %d", field(1), groupAccounts)
+			}
+			if count, _ := strconv.Atoi(field(2)); count != groupRecords {
+				return statement, fail("group record count %s, found %d", field(2), groupRecords)
+			}
+			fileTotal += groupTotal
+			groups++
+
+		case "99":
+			total, err := parseBAI2Amount(field(0))
+			if err != nil {
+				return statement, fail("%v", err)
+			}
+			if total != fileTotal {
+				return statement, fail("file control total %d, groups add up to %d", total, fileTotal)
+			}
+			if count, _ := strconv.Atoi(field(1)); count != groups {
+				return statement, fail("file group count %s, found %d", field(1), groups)
+			}
+			if count, _ := strconv.Atoi(field(2)); count != fileRecords {
+				return statement, fail("file record count %s, found %d", field(2), fileRecords)
+			}
+			// Ledger balances only stand for the file when it holds one account
+			if accounts == 1 {
+				statement.Opening, statement.Closing = opening, closing
+			}
+			return statement, nil
+
+		default:
+			return statement, fail("unknown record type")
+		}
+	}
+
+	return statement, fmt.Errorf("no file trailer")
+}
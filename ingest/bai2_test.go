@@ -0,0 +1,87 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// BAI2 file of one group and account: opening ledger 1000.00, closing
+// 1174.50, a deposit and a check whose text runs on in an 88 record
+const bai2File = `01,SENDER,RECEIVER,240106,1200,1,,,2/
+02,RECEIVER,BANK,1,240105,,USD,2/
+03,12345,USD,010,100000,,,015,117450,,/
+16,195,25000,Z,BANKREF1,CUSTREF1,Deposit
+16,475,7550,0,,CHK100,Check
+88,number 100
+49,250000,5/
+98,250000,1,7/
+99,250000,1,9/
+`
+
+func TestParseBAI2(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		balances string
+		want     []string
+		err      string
+	}{
+		{
+			name:     "file",
+			balances: "1000.00 1174.50",
+			want:     []string{"BANKREF1 2024-01-05 250.00 credit", "CHK100 2024-01-05 -75.50 debit"},
+		},
+		{
+			name:     "no references",
+			old:      "16,195,25000,Z,BANKREF1,CUSTREF1,Deposit",
+			new:      "16,195,25000,V,240106,1200,,,Deposit",
+			balances: "1000.00 1174.50",
+			want:     []string{"BAI2-4 2024-01-05 250.00 credit", "CHK100 2024-01-05 -75.50 debit"},
+		},
+		{
+			name: "account control total",
+			old:  "49,250000,5/",
+			new:  "49,250001,5/",
+			err:  "account control total",
+		},
+		{
+			name: "file record count",
+			old:  "99,250000,1,9/",
+			new:  "99,250000,1,8/",
+			err:  "file record count",
+		},
+		{
+			name: "type code",
+			old:  "16,475,",
+			new:  "16,700,",
+			err:  "neither a credit nor a debit",
+		},
+		{
+			name: "no trailer",
+			old:  "99,250000,1,9/\n",
+			err:  "no file trailer",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := bai2File
+			if tc.old != "" {
+				data = strings.Replace(data, tc.old, tc.new, 1)
+			}
+			document, err := Parse("cash.bai", []byte(data), Options{})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != "bai2" || document.Account != "12345" || document.Currency != "USD" {
+				t.Errorf("format %q, account %q, currency %q", document.Format, document.Account, document.Currency)
+			}
+			if document.Opening == nil || document.Closing == nil {
+				t.Fatalf("balances %v and %v", document.Opening, document.Closing)
+			}
+			if balances := fmt.Sprintf("%.2f %.2f", *document.Opening, *document.Closing); balances != tc.balances {
+				t.Errorf("balances %s, want %s", balances, tc.balances)
+			}
+			checkEntries(t, document.Entries, tc.want)
+		})
+	}
+}
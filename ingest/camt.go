@@ -0,0 +1,283 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ISO 20022 bank-to-customer document: a camt.053 statement or a camt.054
+// debit/credit notification. Elements are matched by local name, so any
+// version of the schema reads.
+type camtDocument struct {
+	Statements    []camtReport `xml:"BkToCstmrStmt>Stmt"`
+	Notifications []camtReport `xml:"BkToCstmrDbtCdtNtfctn>Ntfctn"`
+}
+
+// Statement or notification of a camt document
+type camtReport struct {
+	ID       string        `xml:"Id"`
+	Account  camtAccount   `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAccount struct {
+	IBAN     string `xml:"Id>IBAN"`
+	Other    string `xml:"Id>Othr>Id"`
+	Currency string `xml:"Ccy"`
+}
+
+type camtBalance struct {
+	Type      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// Date of a camt entry, a date or a date and time
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// Entry status: a plain code up to version 2 of the schemas and a Cd
+// element from there on
+type camtStatus struct {
+	Code string `xml:"Cd"`
+	Text string `xml:",chardata"`
+}
+
+type camtEntry struct {
+	Reference      string            `xml:"NtryRef"`
+	Amount         camtAmount        `xml:"Amt"`
+	Indicator      string            `xml:"CdtDbtInd"`
+	Status         camtStatus        `xml:"Sts"`
+	BookingDate    camtDate          `xml:"BookgDt"`
+	ValueDate      camtDate          `xml:"ValDt"`
+	ServicerRef    string            `xml:"AcctSvcrRef"`
+	Details        []camtTransaction `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo string            `xml:"AddtlNtryInf"`
+}
+
+// Transaction details of an entry; a batch entry has one per transaction
+type camtTransaction struct {
+	ServicerRef    string     `xml:"Refs>AcctSvcrRef"`
+	EndToEndID     string     `xml:"Refs>EndToEndId"`
+	Amount         camtAmount `xml:"Amt"`
+	TxAmount       camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Indicator      string     `xml:"CdtDbtInd"`
+	Unstructured   []string   `xml:"RmtInf>Ustrd"`
+	CreditorRefs   []string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	AdditionalInfo string     `xml:"AddtlTxInf"`
+}
+
+// ISO 20022 camt.053 statements and camt.054 notifications
+var camtFormat = format{name: "camt", detect: isCamt, parse: func(r io.Reader, _ Options) (Document, error) {
+	return parseCamt(r)
+}}
+
+// Whether a file is a camt.053 or camt.054 document, by the namespace of its
+// root element or, without one, by the message it holds
+func isCamt(_ string, head []byte) bool {
+	root, space := xmlRoot(head)
+	if root != "Document" {
+		return false
+	}
+	if strings.Contains(space, ":camt.053.") || strings.Contains(space, ":camt.054.") {
+		return true
+	}
+	return bytes.Contains(head, []byte("BkToCstmrStmt")) || bytes.Contains(head, []byte("BkToCstmrDbtCdtNtfctn"))
+}
+
+// Parse a camt.053 or camt.054 document. Entries take their booking date,
+// or their value date when they have none, and their side from CdtDbtInd,
+// which already tells the direction of reversals. A batch entry expands into
+// one entry per transaction detail, unless a detail has no amount, when it
+// stays a single entry of the batch amount; references are the servicer's
+// reference, then the end-to-end ID, and descriptions the remittance
+// information. Pending and information-only entries are skipped. The
+// balances are the opening booked balance of the first statement and the
+// closing booked balance of the last one; notifications carry none.
+func parseCamt(r io.Reader) (Document, error) {
+	var document camtDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return Document{}, err
+	}
+
+	statement := Document{Format: "camt.053", Kind: KindStatement}
+	reports := document.Statements
+	if len(reports) == 0 {
+		statement.Format = "camt.054"
+		reports = document.Notifications
+	}
+	if len(reports) == 0 {
+		return statement, fmt.Errorf("no statement or notification")
+	}
+
+	for i, report := range reports {
+		if statement.Account == "" {
+			statement.Account = report.Account.IBAN
+			if statement.Account == "" {
+				statement.Account = report.Account.Other
+			}
+			statement.Currency = report.Account.Currency
+		}
+
+		for _, balance := range report.Balances {
+			amount, err := camtSignedAmount(balance.Amount, balance.Indicator)
+			if err != nil {
+				return statement, fmt.Errorf("%s balance: %w", balance.Type, err)
+			}
+			switch balance.Type {
+			case "OPBD", "PRCD":
+				if statement.Opening == nil {
+					statement.Opening = &amount
+				}
+			case "CLBD":
+				statement.Closing = &amount
+			}
+		}
+
+		for j, entry := range report.Entries {
+			status := strings.TrimSpace(entry.Status.Code + entry.Status.Text)
+			if status == "PDNG" || status == "INFO" {
+				continue
+			}
+			source := fmt.Sprintf("Stmt %d Ntry %d", i+1, j+1)
+
+			date, err := camtEntryDate(entry)
+			if err != nil {
+				return statement, fmt.Errorf("%s: %w", source, err)
+			}
+
+			if len(entry.Details) > 1 && camtDetailAmounts(entry.Details) {
+				for k, details := range entry.Details {
+					amount := details.Amount
+					if amount.Value == "" {
+						amount = details.TxAmount
+					}
+					indicator := details.Indicator
+					if indicator == "" {
+						indicator = entry.Indicator
+					}
+					value, err := camtSignedAmount(amount, indicator)
+					if err != nil {
+						return statement, fmt.Errorf("%s TxDtls %d: %w", source, k+1, err)
+					}
+					reference := camtReference(details)
+					if reference == "" {
+						reference = fmt.Sprintf("%s/%d", camtReference(camtTransaction{}, entry.ServicerRef, entry.Reference), k+1)
+					}
+					statement.Entries = append(statement.Entries, Entry{
+						Reference:   reference,
+						Date:        date,
+						Amount:      value,
+						Description: camtDescription(details, entry.AdditionalInfo),
+						Source:      fmt.Sprintf("%s TxDtls %d", source, k+1),
+					})
+				}
+				continue
+			}
+
+			value, err := camtSignedAmount(entry.Amount, entry.Indicator)
+			if err != nil {
+				return statement, fmt.Errorf("%s: %w", source, err)
+			}
+			var details camtTransaction
+			if len(entry.Details) == 1 {
+				details = entry.Details[0]
+			}
+			statement.Entries = append(statement.Entries, Entry{
+				Reference:   camtReference(details, entry.ServicerRef, entry.Reference),
+				Date:        date,
+				Amount:      value,
+				Description: camtDescription(details, entry.AdditionalInfo),
+				Source:      source,
+			})
+		}
+	}
+
+	statement.sideBySign(Credit)
+	return statement, nil
+}
+
+// Whether every transaction detail of a batch entry has an amount of its own
+func camtDetailAmounts(details []camtTransaction) bool {
+	for _, transaction := range details {
+		if strings.TrimSpace(transaction.Amount.Value) == "" && strings.TrimSpace(transaction.TxAmount.Value) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Amount signed by its credit/debit indicator: credits are positive and
+// debits negative
+func camtSignedAmount(amount camtAmount, indicator string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(amount.Value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", amount.Value)
+	}
+	switch indicator {
+	case "CRDT":
+	case "DBIT":
+		value = -value
+	default:
+		return 0, fmt.Errorf("invalid CdtDbtInd %q", indicator)
+	}
+	return value, nil
+}
+
+// Booking date of an entry, or its value date when it has none
+func camtEntryDate(entry camtEntry) (time.Time, error) {
+	for _, date := range []camtDate{entry.BookingDate, entry.ValueDate} {
+		switch {
+		case date.Date != "":
+			return time.Parse("2006-01-02", date.Date)
+		case len(date.DateTime) >= 10:
+			return time.Parse("2006-01-02", date.DateTime[:10])
+		}
+	}
+	return time.Time{}, fmt.Errorf("no booking or value date")
+}
+
+// First reference of the transaction details, then of the fallbacks, that is
+// set. NOTPROVIDED end-to-end IDs don't count.
+func camtReference(details camtTransaction, fallbacks ...string) string {
+	endToEndID := details.EndToEndID
+	if endToEndID == "NOTPROVIDED" {
+		endToEndID = ""
+	}
+	for _, reference := range append([]string{details.ServicerRef, endToEndID}, fallbacks...) {
+		if reference = strings.TrimSpace(reference); reference != "" {
+			return reference
+		}
+	}
+	return ""
+}
+
+// Remittance information of the transaction details, falling back to the
+// additional information of the details or of the entry
+func camtDescription(details camtTransaction, entryInfo string) string {
+	for _, parts := range [][]string{details.Unstructured, details.CreditorRefs, {details.AdditionalInfo}, {entryInfo}} {
+		var texts []string
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part != "" {
+				texts = append(texts, part)
+			}
+		}
+		if len(texts) > 0 {
+			return strings.Join(texts, " ")
+		}
+	}
+	return ""
+}
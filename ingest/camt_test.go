@@ -0,0 +1,88 @@
+package ingest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// camt.053 document of one statement holding the given entries
+func camtStatement(entries string) string {
+	return `<?xml version="1.0"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"><BkToCstmrStmt><Stmt>
+<Id>S1</Id><Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>
+<Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">100.00</Amt><CdtDbtInd>CRDT</CdtDbtInd></Bal>
+<Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">50.00</Amt><CdtDbtInd>DBIT</CdtDbtInd></Bal>
+` + entries + `
+</Stmt></BkToCstmrStmt></Document>`
+}
+
+func TestParseCamt(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		entries string
+		want    []string
+		err     string
+	}{
+		{
+			name: "credit and debit",
+			entries: `<Ntry><NtryRef>R1</NtryRef><Amt Ccy="EUR">250.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-05</Dt></BookgDt></Ntry>
+<Ntry><Amt Ccy="EUR">75.50</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts><ValDt><DtTm>2024-01-06T10:00:00</DtTm></ValDt><AcctSvcrRef>SVC2</AcctSvcrRef></Ntry>`,
+			want: []string{"R1 2024-01-05 250.00 credit", "SVC2 2024-01-06 -75.50 debit"},
+		},
+		{
+			name: "reversal follows CdtDbtInd",
+			entries: `<Ntry><NtryRef>R1</NtryRef><Amt Ccy="EUR">40.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><RvslInd>true</RvslInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-05</Dt></BookgDt></Ntry>
+<Ntry><NtryRef>R2</NtryRef><Amt Ccy="EUR">40.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><RvslInd>true</RvslInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-05</Dt></BookgDt></Ntry>`,
+			want: []string{"R1 2024-01-05 -40.00 debit", "R2 2024-01-05 40.00 credit"},
+		},
+		{
+			name: "pending and information skipped",
+			entries: `<Ntry><NtryRef>R1</NtryRef><Amt Ccy="EUR">1.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>PDNG</Sts><BookgDt><Dt>2024-01-05</Dt></BookgDt></Ntry>
+<Ntry><NtryRef>R2</NtryRef><Amt Ccy="EUR">2.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts><Cd>INFO</Cd></Sts><BookgDt><Dt>2024-01-05</Dt></BookgDt></Ntry>`,
+			want: []string{},
+		},
+		{
+			name: "batch",
+			entries: `<Ntry><NtryRef>B1</NtryRef><Amt Ccy="EUR">300.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-07</Dt></BookgDt><NtryDtls>
+<TxDtls><Refs><EndToEndId>E1</EndToEndId></Refs><Amt Ccy="EUR">100.00</Amt></TxDtls>
+<TxDtls><Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs><AmtDtls><TxAmt><Amt Ccy="EUR">200.00</Amt></TxAmt></AmtDtls></TxDtls>
+</NtryDtls></Ntry>`,
+			want: []string{"E1 2024-01-07 100.00 credit", "B1/2 2024-01-07 200.00 credit"},
+		},
+		{
+			name: "batch detail without amount",
+			entries: `<Ntry><NtryRef>B1</NtryRef><Amt Ccy="EUR">300.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-07</Dt></BookgDt><NtryDtls>
+<TxDtls><Refs><EndToEndId>E1</EndToEndId></Refs><Amt Ccy="EUR">100.00</Amt></TxDtls>
+<TxDtls><Refs><EndToEndId>E2</EndToEndId></Refs></TxDtls>
+</NtryDtls></Ntry>`,
+			want: []string{"B1 2024-01-07 300.00 credit"},
+		},
+		{
+			name:    "bad indicator",
+			entries: `<Ntry><NtryRef>R1</NtryRef><Amt Ccy="EUR">1.00</Amt><CdtDbtInd>XX</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-05</Dt></BookgDt></Ntry>`,
+			err:     "invalid CdtDbtInd",
+		},
+		{
+			name:    "no date",
+			entries: `<Ntry><NtryRef>R1</NtryRef><Amt Ccy="EUR">1.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts></Ntry>`,
+			err:     "no booking or value date",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			document, err := Parse("statement.xml", []byte(camtStatement(tc.entries)), Options{})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != "camt.053" || document.Account != "DE89370400440532013000" || document.Currency != "EUR" {
+				t.Errorf("format %q, account %q, currency %q", document.Format, document.Account, document.Currency)
+			}
+			if document.Opening == nil || document.Closing == nil {
+				t.Fatalf("balances %v and %v", document.Opening, document.Closing)
+			}
+			if balances := fmt.Sprintf("%.2f %.2f", *document.Opening, *document.Closing); balances != "100.00 -50.00" {
+				t.Errorf("balances %s, want 100.00 -50.00", balances)
+			}
+			checkEntries(t, document.Entries, tc.want)
+		})
+	}
+}
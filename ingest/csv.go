@@ -0,0 +1,210 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/cleaner"
+)
+
+// Normalized CSV of the cleaner: reference, date as 1/2/2006, amount and
+// optionally the source of each row, in the dialect of the options. The
+// entries have no side; it's the one the file is given for. As the format
+// of last resort, a file with rows none of which read is an error rather
+// than an empty document; a file without rows is empty.
+var csvFormat = format{name: "csv", detect: isCSV, parse: func(r io.Reader, options Options) (Document, error) {
+	document, err := parseCSV(r, options.CSV)
+	if err == nil && len(document.Entries) == 0 && len(document.Rejected) > 0 {
+		first := document.Rejected[0]
+		return document, fmt.Errorf("none of the %d rows could be read; line %d: %s", len(document.Rejected), first.Line, first.Reason)
+	}
+	return document, err
+}}
+
+// Field delimiters CSV files are sniffed for, the default first
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+// Whether an input is text CSV can be read from: UTF-16 text or anything
+// else without NUL bytes
+func isCSV(_ string, head []byte) bool {
+	switch sniffEncoding(head) {
+	case encodingUTF16LE, encodingUTF16BE:
+		return true
+	}
+	return bytes.IndexByte(head, 0) < 0
+}
+
+// Delimiter of a CSV file: the one that splits the first lines into the
+// same number of fields, the most of them, comma when none does
+func sniffDelimiter(head []byte) rune {
+	// The last line may be cut off
+	if i := bytes.LastIndexByte(head, '\n'); i > 0 && len(head) >= sniffLength {
+		head = head[:i]
+	}
+
+	best, bestFields := csvDelimiters[0], 1
+	for _, delimiter := range csvDelimiters {
+		reader := csv.NewReader(bytes.NewReader(head))
+		reader.Comma = delimiter
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		records, err := reader.ReadAll()
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		fields := len(records[0])
+		for _, record := range records[1:] {
+			if len(record) != fields {
+				fields = 0
+				break
+			}
+		}
+		if fields > bestFields {
+			best, bestFields = delimiter, fields
+		}
+	}
+	return best
+}
+
+// Read CSV rows in a dialect, collecting the ones that had to be skipped.
+// Amounts may carry currency symbols and thousands separators, and
+// negatives may be in parentheses or have a trailing minus.
+func parseCSV(r io.Reader, dialect Dialect) (Document, error) {
+	document := Document{Format: "csv", Kind: KindTable}
+	if err := dialect.Validate(); err != nil {
+		return document, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return document, err
+	}
+	text, err := decodeText(data, dialect.Encoding)
+	if err != nil {
+		return document, err
+	}
+
+	quote := dialect.quote()
+	if quote != '"' {
+		text = []byte(swapQuotes(string(text), quote))
+	}
+	reader := csv.NewReader(bytes.NewReader(text))
+	reader.Comma = dialect.delimiter()
+	if reader.Comma == 0 {
+		reader.Comma = sniffDelimiter(text[:min(len(text), sniffLength)])
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	type row struct {
+		line   int
+		record []string
+	}
+	var rows []row
+	var amounts []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			document.Rejected = append(document.Rejected, Rejected{Line: parseErr.StartLine, Record: record, Reason: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return document, err
+		}
+		if quote != '"' {
+			for i := range record {
+				record[i] = swapQuotes(record[i], quote)
+			}
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, row{line: line, record: record})
+		if len(record) >= 3 {
+			amounts = append(amounts, record[2])
+		}
+	}
+
+	decimal := dialect.decimal()
+	if decimal == "" {
+		decimal = detectDecimal(amounts)
+	}
+
+	for _, row := range rows {
+		record := row.record
+		reject := func(reason string) {
+			document.Rejected = append(document.Rejected, Rejected{Line: row.line, Record: record, Reason: reason})
+		}
+
+		if len(record) < 3 {
+			reject(fmt.Sprintf("expected at least 3 fields, got %d", len(record)))
+			continue
+		}
+
+		amount := record[2]
+		if dialect.Thousands != "" {
+			amount = strings.ReplaceAll(amount, dialect.Thousands, "")
+		}
+		value, err := cleaner.ParseAmount(amount, decimal)
+		if err != nil {
+			reject(fmt.Sprintf("invalid value for transaction %s: %v", record[0], err))
+			continue
+		}
+
+		date, err := time.Parse("1/2/2006", strings.TrimSpace(record[1]))
+		if err != nil {
+			reject(fmt.Sprintf("invalid date for transaction %s: %v", record[0], err))
+			continue
+		}
+
+		entry := Entry{
+			Reference: strings.TrimSpace(record[0]),
+			Amount:    value,
+			Date:      date,
+		}
+		if len(record) > 3 {
+			entry.Source = record[3]
+		}
+
+		document.Entries = append(document.Entries, entry)
+	}
+
+	return document, nil
+}
+
+// WriteCSV writes entries as the normalized CSV of the cleaner, with
+// unsigned amounts, as the side is the file's.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	for _, entry := range entries {
+		amount := strconv.FormatFloat(roundCents(entry.Amount), 'f', -1, 64)
+		row := []string{entry.Reference, entry.Date.Format("1/2/2006"), strings.TrimPrefix(amount, "-"), entry.Source}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteRejectedCSV writes the rows of an input that couldn't be read, under
+// a header: the line, the reason and the fields as read.
+func WriteRejectedCSV(w io.Writer, rejected []Rejected) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Line", "Reason", "Record"}); err != nil {
+		return err
+	}
+	for _, row := range rejected {
+		if err := writer.Write(append([]string{strconv.Itoa(row.Line), row.Reason}, row.Record...)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Files of the corpus in testdata/csv and what they read as, see its README
+func TestParseCSVCorpus(t *testing.T) {
+	for _, tc := range []struct {
+		file     string
+		dialect  Dialect
+		want     []string
+		rejected []int
+		err      string
+	}{
+		{file: "semicolon-decimal-comma.csv", want: []string{"INV-1001 2024-01-02 1234.56", "INV-1002 2024-01-03 99.90", "INV-1003 2024-01-04 -12.00"}},
+		{file: "utf8-bom.csv", want: []string{"PAY-1 2024-01-02 100.00", "PAY-2 2024-01-05 250.50"}},
+		{file: "excel-unicode-text.txt", want: []string{"Ré-001 2024-01-02 1500.00", "Ré-002 2024-01-03 75.25"}},
+		{file: "utf16be-no-bom.csv", want: []string{"A-1 2024-01-02 10.00", "A-2 2024-01-03 20.00"}},
+		{file: "windows-1252.csv", want: []string{"Café-1 2024-01-02 1250.00", "Naïve-2 2024-01-03 80.00", "Smørrebrød-3 2024-01-04 3.50"}},
+		{file: "quoted-fields.csv", want: []string{"INV, 1 2024-01-02 1234.50", `INV "2" 2024-01-03 500.00`, `INV 3 "rush" 2024-01-04 42.00`}},
+		{file: "pipe-thousands.csv", want: []string{"W-1 2024-01-02 1234567.89", "W-2 2024-01-03 12345.00", "W-3 2024-01-04 0.99"}},
+		{file: "single-quote.csv", dialect: Dialect{Quote: "'"}, want: []string{"Smith; John 2024-01-02 1000.00", "O'Brien 2024-01-03 250.00"}},
+		{file: "single-quote.csv", err: "none of the 2 rows could be read"},
+		{file: "apostrophe-thousands.csv", want: []string{"CH-1 2024-01-02 1234.50", "CH-2 2024-01-03 12000.00"}},
+		{file: "accounting-negatives.csv", want: []string{"N-1 2024-01-02 -1234.56", "N-2 2024-01-03 -99.00", "N-3 2024-01-04 -5.00", "N-4 2024-01-05 7.50"}},
+		{file: "ragged-rows.csv", want: []string{"R-1 2024-01-02 10.00", "R-5 2024-01-06 30.00"}, rejected: []int{3, 4, 5}},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "csv", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			document, err := Parse(tc.file, data, Options{CSV: tc.dialect})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != "csv" {
+				t.Errorf("read as %s", document.Format)
+			}
+			checkEntries(t, document.Entries, tc.want)
+			var lines []int
+			for _, row := range document.Rejected {
+				lines = append(lines, row.Line)
+			}
+			if len(lines) != len(tc.rejected) {
+				t.Fatalf("rejected lines %v, want %v", lines, tc.rejected)
+			}
+			for i := range lines {
+				if lines[i] != tc.rejected[i] {
+					t.Errorf("rejected lines %v, want %v", lines, tc.rejected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCSVEmpty(t *testing.T) {
+	document, err := Parse("empty.csv", []byte("\n\n"), Options{})
+	if err != nil || len(document.Entries) != 0 || len(document.Rejected) != 0 {
+		t.Errorf("empty file: %d entries, %d rejected, error %v", len(document.Entries), len(document.Rejected), err)
+	}
+}
@@ -0,0 +1,246 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encodings CSV files can be read in
+const (
+	encodingUTF8        = "utf-8"
+	encodingUTF16LE     = "utf-16le"
+	encodingUTF16BE     = "utf-16be"
+	encodingWindows1252 = "windows-1252"
+)
+
+// Byte order marks
+var (
+	bomUTF8    = []byte("\xef\xbb\xbf")
+	bomUTF16LE = []byte("\xff\xfe")
+	bomUTF16BE = []byte("\xfe\xff")
+)
+
+// Dialect of a CSV file. Fields left empty are worked out from the file: the
+// encoding from its byte order mark or, without one, UTF-16 by its NUL
+// bytes, UTF-8 when it's valid and Windows-1252 otherwise; the delimiter
+// from its first lines; and the decimal separator from its amounts. Quote
+// defaults to the double quote. Thousands separators are dropped from the
+// amounts; a thousands separator of "." or "," makes the other one the
+// decimal separator.
+type Dialect struct {
+	Delimiter string `json:"delimiter,omitempty"` // one character, or "tab"
+	Quote     string `json:"quote,omitempty"`
+	Encoding  string `json:"encoding,omitempty"` // utf-8, utf-16le, utf-16be or windows-1252
+	Decimal   string `json:"decimal,omitempty"`  // "." or ","
+	Thousands string `json:"thousands,omitempty"`
+}
+
+// FormDialect reads a dialect from the csv_delimiter, csv_quote,
+// csv_encoding, csv_decimal and csv_thousands fields of a form, given its
+// value getter, e.g. (*http.Request).FormValue.
+func FormDialect(value func(string) string) Dialect {
+	return Dialect{
+		Delimiter: value("csv_delimiter"),
+		Quote:     value("csv_quote"),
+		Encoding:  value("csv_encoding"),
+		Decimal:   value("csv_decimal"),
+		Thousands: value("csv_thousands"),
+	}
+}
+
+// Validate checks that the set fields of a dialect can be used.
+func (d Dialect) Validate() error {
+	if d.Delimiter != "" && d.delimiter() == 0 {
+		return fmt.Errorf("invalid CSV delimiter %q, expected one character", d.Delimiter)
+	}
+	if d.Quote != "" && utf8.RuneCountInString(d.Quote) != 1 {
+		return fmt.Errorf("invalid CSV quote %q, expected one character", d.Quote)
+	}
+	if d.Quote != "" && d.delimiter() == d.quote() {
+		return fmt.Errorf("the CSV quote and delimiter are both %q", d.Quote)
+	}
+	switch strings.ToLower(d.Encoding) {
+	case "", encodingUTF8, encodingUTF16LE, encodingUTF16BE, encodingWindows1252:
+	default:
+		return fmt.Errorf("unknown CSV encoding %q, expected %s, %s, %s or %s", d.Encoding, encodingUTF8, encodingUTF16LE, encodingUTF16BE, encodingWindows1252)
+	}
+	if d.Decimal != "" && d.Decimal != "." && d.Decimal != "," {
+		return fmt.Errorf("invalid decimal separator %q, expected . or ,", d.Decimal)
+	}
+	if d.Thousands != "" && utf8.RuneCountInString(d.Thousands) != 1 {
+		return fmt.Errorf("invalid thousands separator %q, expected one character", d.Thousands)
+	}
+	if d.Thousands != "" && d.Thousands == d.Decimal {
+		return fmt.Errorf("the decimal and thousands separators are both %q", d.Decimal)
+	}
+	return nil
+}
+
+// Delimiter of the dialect, 0 when it's to be sniffed or isn't one character
+func (d Dialect) delimiter() rune {
+	switch d.Delimiter {
+	case "":
+		return 0
+	case "tab", `\t`:
+		return '\t'
+	}
+	r, size := utf8.DecodeRuneInString(d.Delimiter)
+	if size != len(d.Delimiter) || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0
+	}
+	return r
+}
+
+// Quote character of the dialect
+func (d Dialect) quote() rune {
+	if d.Quote == "" {
+		return '"'
+	}
+	r, _ := utf8.DecodeRuneInString(d.Quote)
+	return r
+}
+
+// Decimal separator of the dialect, empty when it's to be worked out from
+// the amounts
+func (d Dialect) decimal() string {
+	switch {
+	case d.Decimal != "":
+		return d.Decimal
+	case d.Thousands == ".":
+		return ","
+	case d.Thousands == ",":
+		return "."
+	}
+	return ""
+}
+
+// Encoding of a file by its byte order mark or, without one, by its bytes:
+// text with NUL bytes in every other position is UTF-16, and text that
+// isn't valid UTF-8 Windows-1252
+func sniffEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		return encodingUTF8
+	case bytes.HasPrefix(head, bomUTF16LE):
+		return encodingUTF16LE
+	case bytes.HasPrefix(head, bomUTF16BE):
+		return encodingUTF16BE
+	}
+
+	var even, odd int
+	for i, b := range head {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	half := len(head) / 2
+	switch {
+	case half > 0 && odd > half*9/10 && even == 0:
+		return encodingUTF16LE
+	case half > 0 && even > half*9/10 && odd == 0:
+		return encodingUTF16BE
+	}
+
+	// The head may end in the middle of a character
+	for i := 0; i < utf8.UTFMax && i < len(head); i++ {
+		if utf8.Valid(head[:len(head)-i]) {
+			return encodingUTF8
+		}
+	}
+	return encodingWindows1252
+}
+
+// Decode a file to UTF-8 without its byte order mark. The encoding is
+// sniffed when none is given.
+func decodeText(data []byte, name string) ([]byte, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		name = sniffEncoding(data)
+	}
+
+	var decoding encoding.Encoding
+	switch name {
+	case encodingUTF8:
+		return bytes.TrimPrefix(data, bomUTF8), nil
+	case encodingUTF16LE:
+		decoding = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case encodingUTF16BE:
+		decoding = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case encodingWindows1252:
+		decoding = charmap.Windows1252
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+
+	text, err := decoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return bytes.TrimPrefix(text, bomUTF8), nil
+}
+
+// Swap the quote character of a dialect with the double quote, the one the
+// CSV reader knows. Swapping again restores the text.
+func swapQuotes(text string, quote rune) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case quote:
+			return '"'
+		case '"':
+			return quote
+		}
+		return r
+	}, text)
+}
+
+// Decimal separator of a file's amounts. Where both separators appear the
+// last one is the decimal separator, a separator that appears more than once
+// is the thousands one, and a lone separator is the decimal one unless three
+// digits follow it, as in 1,234. Amounts that don't tell either way don't
+// count; the dot wins when none do, or when they disagree.
+func detectDecimal(amounts []string) string {
+	var dots, commas int
+	for _, amount := range amounts {
+		dot, comma := strings.LastIndex(amount, "."), strings.LastIndex(amount, ",")
+		switch {
+		case dot >= 0 && comma >= 0:
+			if comma > dot {
+				commas++
+			} else {
+				dots++
+			}
+		case strings.Count(amount, ",") > 1:
+			dots++
+		case strings.Count(amount, ".") > 1:
+			commas++
+		case comma >= 0 && leadingDigits(amount[comma+1:]) != 3:
+			commas++
+		case dot >= 0 && leadingDigits(amount[dot+1:]) != 3:
+			dots++
+		}
+	}
+	if commas > 0 && dots == 0 {
+		return ","
+	}
+	return "."
+}
+
+// Number of digits a string starts with
+func leadingDigits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
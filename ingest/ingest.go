@@ -0,0 +1,239 @@
+// Package ingest reads the inputs of a reconciliation: the normalized CSV of
+// the cleaner, ERP workbooks, bank statements (OFX, camt.053/054, MT940/942,
+// BAI2), plain-text accounting journals and JSON transaction records. Every
+// format is a Parser in a registry, and Parse tells the format of an input
+// by its name and content, so the reconciler and the clean API read all of
+// them the same way.
+package ingest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin/cleaner"
+)
+
+// Kinds of documents
+const (
+	KindTable     = "table"     // CSV rows of one side, or workbook rows of both
+	KindStatement = "statement" // bank statement, money in and out
+	KindJournal   = "journal"   // postings of one account of a journal
+)
+
+// Sides of an entry
+const (
+	Credit = "credit"
+	Debit  = "debit"
+)
+
+// Number of bytes of an input the parsers get to detect their format by
+const sniffLength = 4096
+
+// ErrUnknownFormat is returned for inputs no registered parser reads.
+var ErrUnknownFormat = errors.New("unknown input format")
+
+// Document read from an input. Format names the parser that read it, e.g.
+// "camt.053" or "beancount". Opening and Closing are the balances a bank
+// statement carries, nil when it doesn't, and Currency is the commodity of
+// a journal. Rejected holds the rows that couldn't be read.
+type Document struct {
+	Format   string
+	Kind     string
+	Account  string
+	Currency string
+	Entries  []Entry
+	Rejected []Rejected
+	Opening  *float64
+	Closing  *float64
+}
+
+// Entry of a document. Amount is signed the way the input writes it: money
+// in is positive on bank statements, debits to the account are positive in
+// journals, and CSV and workbook rows are as written. Side is the side the
+// entry belongs to, empty when the input doesn't tell, as for CSV. Source
+// locates the entry in the input, e.g. Sheet1!27 or line 12.
+type Entry struct {
+	Reference   string
+	Date        time.Time
+	Amount      float64
+	Side        string
+	Description string
+	Source      string
+}
+
+// Row of an input that couldn't be read as an entry. Line is the 1-based
+// line in the input and Record the fields as read.
+type Rejected struct {
+	Line   int
+	Record []string
+	Reason string
+}
+
+// Options of reading an input. Account is the account whose postings a
+// journal supplies; Profile, DefaultProfile when nil, and Password are used
+// to clean workbooks; CSV is the dialect of CSV files.
+type Options struct {
+	Account  string
+	Profile  *cleaner.Profile
+	Password string
+	CSV      Dialect
+}
+
+// Parser reads one input format.
+type Parser interface {
+	// Name of the format, e.g. "ofx"
+	Name() string
+	// Whether an input is in the format, by its file name and its first
+	// bytes
+	Detect(name string, head []byte) bool
+	// Read a document from the input
+	Parse(r io.Reader, options Options) (Document, error)
+}
+
+// Parser built from functions, for the formats of this package
+type format struct {
+	name   string
+	detect func(name string, head []byte) bool
+	parse  func(r io.Reader, options Options) (Document, error)
+}
+
+func (f format) Name() string                                   { return f.name }
+func (f format) Detect(name string, head []byte) bool           { return f.detect(name, head) }
+func (f format) Parse(r io.Reader, o Options) (Document, error) { return f.parse(r, o) }
+
+// Registered parsers in the order they get to detect an input. CSV comes
+// last, as it reads almost any text.
+var (
+	parsers  []Parser
+	fallback Parser = csvFormat
+)
+
+func init() {
+	for _, p := range []Parser{xlsxFormat, ofxFormat, camtFormat, bai2Format, mt940Format, journalFormat, jsonFormat} {
+		Register(p)
+	}
+}
+
+// Register adds a parser. Parsers get to detect an input in the order they
+// were registered, before the CSV fallback.
+func Register(p Parser) {
+	parsers = append(parsers, p)
+}
+
+// Formats lists the names of the registered formats.
+func Formats() []string {
+	var names []string
+	for _, p := range parsers {
+		names = append(names, p.Name())
+	}
+	return append(names, fallback.Name())
+}
+
+// Detect returns the parser of an input, by its file name and content.
+func Detect(name string, data []byte) (Parser, error) {
+	head := data[:min(len(data), sniffLength)]
+	for _, p := range parsers {
+		if p.Detect(name, head) {
+			return p, nil
+		}
+	}
+	if fallback.Detect(name, head) {
+		return fallback, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Parse reads an input in whichever registered format it's in.
+func Parse(name string, data []byte, options Options) (Document, error) {
+	p, err := Detect(name, data)
+	if err != nil {
+		return Document{}, err
+	}
+	document, err := p.Parse(bytes.NewReader(data), options)
+	if err != nil {
+		return document, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	return document, nil
+}
+
+// Split the entries of a document by side, for outputs that hold the
+// credits and debits apart. Entries without a side go to side.
+func (d Document) Split(side string) (credits, debits []Entry) {
+	for _, entry := range d.Entries {
+		entrySide := entry.Side
+		if entrySide == "" {
+			entrySide = side
+		}
+		if entrySide == Debit {
+			debits = append(debits, entry)
+		} else {
+			credits = append(credits, entry)
+		}
+	}
+	return credits, debits
+}
+
+// Balances of a bank statement for the roll-forward. A statement that only
+// carries the closing balance has its opening balance worked back from the
+// entries.
+func (d Document) Balances() (opening, closing float64, ok bool) {
+	if d.Closing == nil {
+		return 0, 0, false
+	}
+	closing = *d.Closing
+	if d.Opening != nil {
+		return *d.Opening, closing, true
+	}
+	opening = closing
+	for _, entry := range d.Entries {
+		opening -= entry.Amount
+	}
+	return roundCents(opening), closing, true
+}
+
+// Set the side of every entry by the sign of its amount: positive amounts
+// are on the positive side and the others on the opposite one
+func (d *Document) sideBySign(positive string) {
+	negative := Debit
+	if positive == Debit {
+		negative = Credit
+	}
+	for i := range d.Entries {
+		if d.Entries[i].Amount > 0 {
+			d.Entries[i].Side = positive
+		} else {
+			d.Entries[i].Side = negative
+		}
+	}
+}
+
+// Local name and namespace of the root element of an XML input, empty when
+// the input isn't XML
+func xmlRoot(head []byte) (name, space string) {
+	decoder := xml.NewDecoder(bytes.NewReader(head))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", ""
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token.Name.Local, token.Name.Space
+		case xml.CharData:
+			if len(bytes.TrimSpace(token)) > 0 {
+				return "", ""
+			}
+		}
+	}
+}
+
+// Round an amount to cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
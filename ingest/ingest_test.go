@@ -0,0 +1,41 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Entries of a document as "reference date amount side" lines, without the
+// side when it's empty, to compare against the table of a test
+func entryLines(entries []Entry) []string {
+	lines := []string{}
+	for _, entry := range entries {
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("%s %s %.2f %s", entry.Reference, entry.Date.Format("2006-01-02"), entry.Amount, entry.Side)))
+	}
+	return lines
+}
+
+// Compare the entries of a document with the lines a test expects
+func checkEntries(t *testing.T, entries []Entry, want []string) {
+	t.Helper()
+	got := entryLines(entries)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("entries\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// Check the error of a parse against the substring a test expects, empty
+// for none. It reports whether the parse succeeded.
+func checkError(t *testing.T, err error, want string) bool {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error %v", err)
+	case want != "" && err == nil:
+		t.Fatalf("no error, want %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Fatalf("error %v, want %q", err, want)
+	}
+	return err == nil
+}
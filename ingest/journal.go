@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syntaxes of plain-text accounting journals, the formats of their documents
+const (
+	SyntaxBeancount = "beancount"
+	SyntaxLedger    = "ledger"
+)
+
+// Beancount and ledger-cli journals. Entries are the postings of the
+// account of the options.
+var journalFormat = format{name: "journal", detect: isJournal, parse: func(r io.Reader, options Options) (Document, error) {
+	if options.Account == "" {
+		return Document{}, fmt.Errorf("a journal needs the account to reconcile")
+	}
+	return parseJournal(r, options.Account)
+}}
+
+var (
+	// First line of a journal entry: date, optional auxiliary date and the rest
+	journalHeader = regexp.MustCompile(`^(\d{4}[-/]\d{2}[-/]\d{2})(?:=\S+)?\s+(.*)$`)
+	// Beancount transaction header: flag and quoted payee and narration
+	beancountHeader = regexp.MustCompile(`^(?:\*|!|txn)(?:\s|$)`)
+	beancountString = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+	beancountLink   = regexp.MustCompile(`\^(\S+)`)
+	// Ledger transaction header: optional state, optional code and payee
+	ledgerHeader = regexp.MustCompile(`^(?:[*!]\s*)?(?:\(([^)]*)\)\s*)?(.*)$`)
+	// Amount with its commodity before or after it, e.g. $-1,234.56 or
+	// -60.00 USD
+	journalAmount = regexp.MustCompile(`^(-?)\s*([^-\d.\s]*)\s*(-?)\s*(\d[\d,]*(?:\.\d+)?|\.\d+)\s*(\S*)$`)
+	// Metadata line of a beancount entry or posting, e.g. ref: "INV-100"
+	beancountMetadata = regexp.MustCompile(`^([a-z][a-zA-Z0-9_-]*):\s*(.*)$`)
+	// Dated entry followed by an indented posting
+	journalEntry = regexp.MustCompile(`(?m)^\d{4}[-/]\d{2}[-/]\d{2}[^\n]*\n[ \t]+[A-Z][^\s:]*:`)
+)
+
+// Whether a file is a plain-text accounting journal, by its extension or by
+// a dated entry followed by an indented posting
+func isJournal(name string, head []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".beancount", ".bean", ".ledger", ".journal":
+		return true
+	}
+	return journalEntry.Match(head)
+}
+
+// Read the postings of account from a beancount or ledger-cli journal. The
+// syntax is told by the headers: beancount quotes its payees and narrations.
+// A posting without an amount takes what balances its entry. References are
+// the entry's ref metadata or first link in beancount and its code in
+// ledger, or the line of the posting when there's none. The format of the
+// document is the syntax and its currency the commodity of the first
+// posting.
+func parseJournal(r io.Reader, account string) (Document, error) {
+	j := Document{Format: SyntaxLedger, Kind: KindJournal, Account: account}
+
+	type posting struct {
+		account string
+		amount  *float64
+		ref     string
+		line    int
+	}
+	var (
+		date        time.Time
+		reference   string
+		description string
+		postings    []posting
+		inEntry     bool
+		headerLine  int
+	)
+
+	flush := func() error {
+		defer func() { postings, inEntry = nil, false }()
+		if !inEntry {
+			return nil
+		}
+
+		var sum float64
+		elided := -1
+		for i, p := range postings {
+			if p.amount == nil {
+				if elided >= 0 {
+					return fmt.Errorf("line %d: more than one posting without an amount", headerLine)
+				}
+				elided = i
+				continue
+			}
+			sum += *p.amount
+		}
+
+		n := 0
+		for i, p := range postings {
+			if p.account != account {
+				continue
+			}
+			amount := -sum
+			if i != elided {
+				amount = *p.amount
+			}
+			n++
+			ref := p.ref
+			if ref == "" {
+				ref = reference
+			}
+			switch {
+			case ref == "":
+				ref = fmt.Sprintf("line %d", p.line)
+			case n > 1:
+				ref = fmt.Sprintf("%s/%d", ref, n)
+			}
+			j.Entries = append(j.Entries, Entry{
+				Reference:   ref,
+				Date:        date,
+				Amount:      roundCents(amount),
+				Description: description,
+				Source:      fmt.Sprintf("line %d", p.line),
+			})
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "" || line[0] == ';' || line[0] == '#' || line[0] == '%':
+			if err := flush(); err != nil {
+				return j, err
+			}
+
+		case line[0] != ' ' && line[0] != '\t':
+			if err := flush(); err != nil {
+				return j, err
+			}
+			match := journalHeader.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			rest := match[2]
+			if beancountHeader.MatchString(rest) && (strings.HasPrefix(rest, "txn") || strings.Contains(rest, `"`)) {
+				j.Format = SyntaxBeancount
+				strs := beancountString.FindAllStringSubmatch(rest, -1)
+				var texts []string
+				for _, s := range strs {
+					texts = append(texts, s[1])
+				}
+				description = strings.Join(texts, " ")
+				reference = ""
+				if link := beancountLink.FindStringSubmatch(beancountString.ReplaceAllString(rest, "")); link != nil {
+					reference = link[1]
+				}
+			} else if strings.HasPrefix(rest, "\"") || journalDirective(rest) {
+				// Beancount directives other than transactions
+				continue
+			} else {
+				header := ledgerHeader.FindStringSubmatch(rest)
+				reference = strings.TrimSpace(header[1])
+				description, _, _ = strings.Cut(header[2], ";")
+				description = strings.TrimSpace(description)
+			}
+			var err error
+			date, err = time.Parse("2006-01-02", strings.ReplaceAll(match[1], "/", "-"))
+			if err != nil {
+				return j, fmt.Errorf("line %d: invalid date %q", lineNo, match[1])
+			}
+			inEntry, headerLine = true, lineNo
+
+		case inEntry:
+			if strings.HasPrefix(trimmed, ";") {
+				continue
+			}
+			if meta := beancountMetadata.FindStringSubmatch(trimmed); meta != nil && j.Format == SyntaxBeancount {
+				if meta[1] == "ref" {
+					value := strings.Trim(strings.TrimSpace(meta[2]), `"`)
+					if len(postings) > 0 {
+						postings[len(postings)-1].ref = value
+					} else {
+						reference = value
+					}
+				}
+				continue
+			}
+
+			body, _, _ := strings.Cut(trimmed, ";")
+			body = strings.TrimSpace(strings.TrimLeft(body, "*! "))
+			name, amountText := body, ""
+			if i := strings.IndexAny(body, "\t"); i >= 0 {
+				name, amountText = body[:i], body[i+1:]
+			} else if i := strings.Index(body, "  "); i >= 0 {
+				name, amountText = body[:i], body[i+2:]
+			} else if j.Format == SyntaxBeancount {
+				// Beancount account names have no spaces
+				name, amountText, _ = strings.Cut(body, " ")
+			}
+			p := posting{account: strings.TrimSpace(name), line: lineNo}
+
+			// Drop costs, prices and balance assertions
+			amountText = strings.TrimSpace(amountText)
+			if i := strings.IndexAny(amountText, "@{="); i >= 0 {
+				amountText = strings.TrimSpace(amountText[:i])
+			}
+			if amountText != "" {
+				amount, commodity, err := parseJournalAmount(amountText)
+				if err != nil {
+					return j, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				p.amount = &amount
+				if p.account == account && j.Currency == "" {
+					j.Currency = commodity
+				}
+			}
+			postings = append(postings, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return j, err
+	}
+	if err := flush(); err != nil {
+		return j, err
+	}
+
+	j.sideBySign(Debit)
+	return j, nil
+}
+
+// Whether the rest of a header line is a beancount directive, e.g. open or
+// balance, rather than a transaction
+func journalDirective(rest string) bool {
+	keyword, _, _ := strings.Cut(rest, " ")
+	switch keyword {
+	case "open", "close", "commodity", "balance", "pad", "note", "document", "price", "event", "query", "custom":
+		return true
+	}
+	return false
+}
+
+// Parse a posting amount and its commodity
+func parseJournalAmount(value string) (float64, string, error) {
+	match := journalAmount.FindStringSubmatch(value)
+	if match == nil {
+		return 0, "", fmt.Errorf("invalid amount %q", value)
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(match[4], ",", ""), 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid amount %q", value)
+	}
+	if match[1] == "-" || match[3] == "-" {
+		amount = -amount
+	}
+	commodity := match[2]
+	if commodity == "" {
+		commodity = match[5]
+	}
+	return amount, commodity, nil
+}
@@ -0,0 +1,106 @@
+package ingest
+
+import "testing"
+
+func TestParseJournal(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		file     string
+		data     string
+		account  string
+		format   string
+		currency string
+		want     []string
+		err      string
+	}{
+		{
+			name: "beancount",
+			file: "books.beancount",
+			data: `option "title" "Books"
+2024-01-01 open Assets:Bank USD
+
+2024-01-05 * "Acme" "Invoice 42" ^INV-42
+  Assets:Bank          250.00 USD
+  Income:Sales
+
+2024-01-06 * "Rent"
+  ref: "RENT-1"
+  Expenses:Rent        75.50 USD
+  Assets:Bank
+
+2024-01-07 balance Assets:Bank 174.50 USD
+`,
+			account:  "Assets:Bank",
+			format:   "beancount",
+			currency: "USD",
+			want:     []string{"INV-42 2024-01-05 250.00 debit", "RENT-1 2024-01-06 -75.50 credit"},
+		},
+		{
+			name: "ledger",
+			file: "books.ledger",
+			data: `; ledger-cli journal
+2024/01/05 * (1001) Acme ; invoice 42
+    Assets:Bank        $1,250.00
+    Income:Sales
+
+2024/01/06=2024/01/07 Rent
+    Expenses:Rent    $75.50
+    Assets:Bank      $-75.50
+`,
+			account:  "Assets:Bank",
+			format:   "ledger",
+			currency: "$",
+			want:     []string{"1001 2024-01-05 1250.00 debit", "line 8 2024-01-06 -75.50 credit"},
+		},
+		{
+			name: "two postings to the account",
+			file: "books.ledger",
+			data: `2024/01/05 (T1) Transfer
+    Assets:Bank    10.00 EUR
+    Assets:Bank    -4.00 EUR
+    Equity:Opening
+`,
+			account:  "Assets:Bank",
+			format:   "ledger",
+			currency: "EUR",
+			want:     []string{"T1 2024-01-05 10.00 debit", "T1/2 2024-01-05 -4.00 credit"},
+		},
+		{
+			name: "two elided amounts",
+			file: "books.ledger",
+			data: `2024/01/05 Transfer
+    Assets:Bank
+    Equity:Opening
+`,
+			account: "Assets:Bank",
+			err:     "more than one posting without an amount",
+		},
+		{
+			name: "invalid amount",
+			file: "books.ledger",
+			data: `2024/01/05 Transfer
+    Assets:Bank    ten
+    Equity:Opening
+`,
+			account: "Assets:Bank",
+			err:     "invalid amount",
+		},
+		{
+			name: "no account",
+			file: "books.ledger",
+			data: "2024/01/05 Transfer\n",
+			err:  "needs the account",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			document, err := Parse(tc.file, []byte(tc.data), Options{Account: tc.account})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != tc.format || document.Kind != KindJournal || document.Currency != tc.currency {
+				t.Errorf("format %q, kind %q, currency %q, want %q and %q", document.Format, document.Kind, document.Currency, tc.format, tc.currency)
+			}
+			checkEntries(t, document.Entries, tc.want)
+		})
+	}
+}
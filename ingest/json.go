@@ -0,0 +1,173 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transactions as a JSON array of records or as newline-delimited JSON, one
+// record per line
+var jsonFormat = format{name: "json", detect: isJSON, parse: func(r io.Reader, _ Options) (Document, error) {
+	return parseJSON(r)
+}}
+
+// Transaction record of JSON input, the schema the unmatched items of the
+// JSON result and export share.
+//
+//	side         "credit" or "debit"; may be left out of a file given as
+//	             one side, and tells the sides apart in any other
+//	no           transaction number, or "transaction_no"
+//	date         YYYY-MM-DD
+//	amount       number, or a string holding one
+//	source       where the transaction comes from, optional
+//	description  narrative, optional
+//
+// Other fields are ignored. Records without a side are on the side the file
+// is given for.
+type jsonRecord struct {
+	Side          string     `json:"side"`
+	No            string     `json:"no"`
+	TransactionNo string     `json:"transaction_no"`
+	Date          string     `json:"date"`
+	Amount        jsonAmount `json:"amount"`
+	Source        string     `json:"source"`
+	Description   string     `json:"description"`
+}
+
+// Amount of a JSON record, a number or a string holding one. Set tells a
+// zero amount from a missing one.
+type jsonAmount struct {
+	Value float64
+	Set   bool
+}
+
+func (a *jsonAmount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = strings.TrimSpace(unquoted)
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	a.Value, a.Set = value, true
+	return nil
+}
+
+// Whether an input is JSON, by its extension or by an array or object at
+// its start
+func isJSON(name string, head []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".ndjson", ".jsonl":
+		return true
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, bomUTF8), " \t\r\n")
+	return len(head) > 0 && (head[0] == '[' || head[0] == '{')
+}
+
+// Read transaction records from a JSON array or from newline-delimited JSON.
+// Records that don't fit the schema, and lines of newline-delimited JSON
+// that aren't JSON, are rejected with the line they start on; an array that
+// can't be read is an error.
+func parseJSON(r io.Reader) (Document, error) {
+	document := Document{Format: "json", Kind: KindTable}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return document, err
+	}
+	data = bytes.TrimPrefix(data, bomUTF8)
+
+	add := func(line int, raw []byte) {
+		var record jsonRecord
+		err := json.Unmarshal(raw, &record)
+		var entry Entry
+		if err == nil {
+			entry, err = record.entry()
+		}
+		if err != nil {
+			document.Rejected = append(document.Rejected, Rejected{Line: line, Record: []string{string(raw)}, Reason: err.Error()})
+			return
+		}
+		if entry.Source == "" {
+			entry.Source = fmt.Sprintf("line %d", line)
+		}
+		document.Entries = append(document.Entries, entry)
+	}
+
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("[")) {
+		for i, line := range bytes.Split(data, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				add(i+1, line)
+			}
+		}
+		return document, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return document, err
+	}
+	for decoder.More() {
+		// The record starts after the separator and white space before it
+		offset := decoder.InputOffset()
+		rest := data[offset:]
+		offset += int64(len(rest) - len(bytes.TrimLeft(rest, ", \t\r\n")))
+		line := bytes.Count(data[:offset], []byte("\n")) + 1
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return document, fmt.Errorf("line %d: %w", line, err)
+		}
+		add(line, raw)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return document, err
+	}
+
+	return document, nil
+}
+
+// Entry of a record, checked against the schema
+func (r jsonRecord) entry() (Entry, error) {
+	var entry Entry
+
+	entry.Reference = r.No
+	if entry.Reference == "" {
+		entry.Reference = r.TransactionNo
+	}
+	if entry.Reference == "" {
+		return entry, fmt.Errorf("no transaction number")
+	}
+
+	switch side := strings.ToLower(r.Side); side {
+	case "", Credit, Debit:
+		entry.Side = side
+	default:
+		return entry, fmt.Errorf("invalid side %q for transaction %s", r.Side, entry.Reference)
+	}
+
+	date, err := time.Parse("2006-01-02", r.Date)
+	if err != nil {
+		return entry, fmt.Errorf("invalid date %q for transaction %s", r.Date, entry.Reference)
+	}
+	entry.Date = date
+
+	if !r.Amount.Set {
+		return entry, fmt.Errorf("no amount for transaction %s", entry.Reference)
+	}
+	entry.Amount = r.Amount.Value
+	entry.Source = r.Source
+	entry.Description = r.Description
+
+	return entry, nil
+}
@@ -0,0 +1,74 @@
+package ingest
+
+import "testing"
+
+func TestParseJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		file     string
+		data     string
+		want     []string
+		rejected []int
+		err      string
+	}{
+		{
+			name: "array",
+			file: "transactions.json",
+			data: `[
+  {"side": "credit", "no": "INV-1", "date": "2024-01-05", "amount": 250},
+  {"side": "debit", "transaction_no": "PAY-7", "date": "2024-01-06", "amount": "75.50", "extra": true}
+]`,
+			want: []string{"INV-1 2024-01-05 250.00 credit", "PAY-7 2024-01-06 75.50 debit"},
+		},
+		{
+			name: "ndjson",
+			file: "stdin",
+			data: `{"side": "credit", "no": "INV-1", "date": "2024-01-05", "amount": 250}
+
+{"no": "INV-2", "date": "2024-01-06", "amount": 0}
+not json
+{"side": "both", "no": "X", "date": "2024-01-06", "amount": 1}
+{"side": "debit", "no": "PAY-1", "date": "05/01/2024", "amount": 1}
+{"side": "debit", "no": "PAY-2", "date": "2024-01-07"}
+`,
+			want:     []string{"INV-1 2024-01-05 250.00 credit", "INV-2 2024-01-06 0.00"},
+			rejected: []int{4, 5, 6, 7},
+		},
+		{
+			name:     "array with a bad record",
+			file:     "transactions.json",
+			data:     "[\n{\"no\": \"A\", \"date\": \"2024-01-05\", \"amount\": 1},\n{\"no\": \"B\", \"date\": \"2024-01-05\", \"amount\": \"x\"}\n]",
+			want:     []string{"A 2024-01-05 1.00"},
+			rejected: []int{3},
+		},
+		{
+			name: "broken array",
+			file: "transactions.json",
+			data: `[{"no": "A", "date": "2024-01-05", "amount": 1},`,
+			err:  "unexpected end of JSON input",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			document, err := Parse(tc.file, []byte(tc.data), Options{})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != "json" {
+				t.Errorf("read as %s", document.Format)
+			}
+			checkEntries(t, document.Entries, tc.want)
+			var lines []int
+			for _, row := range document.Rejected {
+				lines = append(lines, row.Line)
+			}
+			if len(lines) != len(tc.rejected) {
+				t.Fatalf("rejected lines %v, want %v", lines, tc.rejected)
+			}
+			for i := range lines {
+				if lines[i] != tc.rejected[i] {
+					t.Errorf("rejected lines %v, want %v", lines, tc.rejected)
+				}
+			}
+		})
+	}
+}
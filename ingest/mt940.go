@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field of an MT940 or MT942 message: its tag, e.g. 61 or 60F, and its
+// lines. Line is where it starts in the file.
+type mtField struct {
+	Tag   string
+	Lines []string
+	Line  int
+}
+
+var (
+	// Start of a field, :61: or :60F:
+	mtFieldStart = regexp.MustCompile(`^:(\d\d[A-Z]?):`)
+	// :61: statement line: value date, optional entry date, debit/credit
+	// mark, optional funds code, amount, transaction type, customer reference
+	// and optional bank reference
+	mtStatementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([A-Z][A-Z0-9]{3})([^/]*)(?://(.*))?$`)
+	// :60F:, :62F: and the like: debit/credit mark, date, currency and amount
+	mtBalance = regexp.MustCompile(`^(C|D)(\d{6})([A-Z]{3})(\d+,\d*)$`)
+)
+
+// SWIFT MT940 statements and MT942 interim transaction reports
+var mt940Format = format{name: "mt940", detect: isMT940, parse: func(r io.Reader, _ Options) (Document, error) {
+	return parseMT940(r)
+}}
+
+// Whether a file is an MT940 or MT942 message, by its fields
+func isMT940(_ string, head []byte) bool {
+	head = head[:min(len(head), 2048)]
+	return bytes.Contains(head, []byte(":20:")) && bytes.Contains(head, []byte(":25:"))
+}
+
+// Read the fields of an MT940 or MT942 file, grouped by message. A message
+// starts with :20: and ends at a - line; SWIFT block headers around it are
+// dropped. Lines that don't start a field continue the one before.
+func readMTMessages(r io.Reader) ([][]mtField, error) {
+	var messages [][]mtField
+	var message []mtField
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r ")
+		if i := strings.Index(line, "{4:"); i >= 0 {
+			line = line[i+3:]
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "{"):
+			continue
+		case trimmed == "-" || strings.HasPrefix(trimmed, "-}"):
+			if len(message) > 0 {
+				messages = append(messages, message)
+				message = nil
+			}
+			continue
+		}
+
+		if match := mtFieldStart.FindStringSubmatch(line); match != nil {
+			if match[1] == "20" && len(message) > 0 {
+				messages = append(messages, message)
+				message = nil
+			}
+			message = append(message, mtField{Tag: match[1], Lines: []string{line[len(match[0]):]}, Line: lineNo})
+			continue
+		}
+		if len(message) == 0 {
+			return nil, fmt.Errorf("line %d: text outside a field", lineNo)
+		}
+		last := &message[len(message)-1]
+		last.Lines = append(last.Lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(message) > 0 {
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// Parse MT940 statements or MT942 interim reports, any number per file.
+// Each :61: line becomes an entry dated by its entry date, or its value date
+// when it has none, with its customer reference, or the bank's when that's
+// NONREF, and its :86: narrative as the description. Reversals (RC, RD)
+// flip the sign of the amount. The balances are the :60F: of the first
+// statement and the :62F: of the last, and every statement's entries must
+// add up from its opening to its closing balance. MT942 carries no
+// balances.
+func parseMT940(r io.Reader) (Document, error) {
+	statement := Document{Format: "mt940", Kind: KindStatement}
+
+	messages, err := readMTMessages(r)
+	if err != nil {
+		return statement, err
+	}
+	if len(messages) == 0 {
+		return statement, fmt.Errorf("no statements")
+	}
+
+	for _, message := range messages {
+		var opening, closing *float64
+		var movements float64
+		var entry *Entry
+
+		for _, field := range message {
+			value := strings.TrimSpace(field.Lines[0])
+			switch field.Tag {
+			case "25":
+				if statement.Account == "" {
+					statement.Account = value
+				}
+			case "13D", "34F":
+				statement.Format = "mt942"
+			case "60F", "60M", "62F", "62M":
+				amount, currency, err := parseMTBalance(value)
+				if err != nil {
+					return statement, fmt.Errorf("line %d: :%s: %w", field.Line, field.Tag, err)
+				}
+				if statement.Currency == "" {
+					statement.Currency = currency
+				}
+				if strings.HasPrefix(field.Tag, "60") {
+					opening = &amount
+				} else {
+					closing = &amount
+				}
+			case "61":
+				parsed, err := parseMTStatementLine(field)
+				if err != nil {
+					return statement, fmt.Errorf("line %d: :61: %w", field.Line, err)
+				}
+				movements += parsed.Amount
+				statement.Entries = append(statement.Entries, parsed)
+				entry = &statement.Entries[len(statement.Entries)-1]
+			case "86":
+				// The narrative belongs to the :61: line right before it
+				if entry != nil {
+					var lines []string
+					for _, line := range field.Lines {
+						if line = strings.TrimSpace(line); line != "" {
+							lines = append(lines, line)
+						}
+					}
+					entry.Description = strings.Join(lines, " ")
+				}
+			}
+			if field.Tag != "61" {
+				entry = nil
+			}
+		}
+
+		if opening != nil && closing != nil && roundCents(*opening+movements) != roundCents(*closing) {
+			return statement, fmt.Errorf("statement starting on line %d: opening balance %.2f and entries %.2f don't add up to closing balance %.2f", message[0].Line, *opening, movements, *closing)
+		}
+		if opening != nil && statement.Opening == nil {
+			statement.Opening = opening
+		}
+		if closing != nil {
+			statement.Closing = closing
+		}
+	}
+
+	statement.sideBySign(Credit)
+	return statement, nil
+}
+
+// Parse a :61: statement line and its supplementary details
+func parseMTStatementLine(field mtField) (Entry, error) {
+	var entry Entry
+
+	match := mtStatementLine.FindStringSubmatch(strings.TrimSpace(field.Lines[0]))
+	if match == nil {
+		return entry, fmt.Errorf("invalid statement line %q", field.Lines[0])
+	}
+
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return entry, fmt.Errorf("invalid value date %q", match[1])
+	}
+	entry.Date = valueDate
+	if match[2] != "" {
+		// The entry date has no year: it's the one of the value date, unless
+		// the two straddle the turn of the year
+		entryDate, err := time.Parse("0102", match[2])
+		if err != nil {
+			return entry, fmt.Errorf("invalid entry date %q", match[2])
+		}
+		year := valueDate.Year()
+		switch {
+		case entryDate.Month() == time.January && valueDate.Month() == time.December:
+			year++
+		case entryDate.Month() == time.December && valueDate.Month() == time.January:
+			year--
+		}
+		entry.Date = time.Date(year, entryDate.Month(), entryDate.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	entry.Amount, err = strconv.ParseFloat(strings.Replace(match[5], ",", ".", 1), 64)
+	if err != nil {
+		return entry, fmt.Errorf("invalid amount %q", match[5])
+	}
+	if match[3] == "D" || match[3] == "RC" {
+		entry.Amount = -entry.Amount
+	}
+
+	entry.Reference = strings.TrimSpace(match[7])
+	if entry.Reference == "" || entry.Reference == "NONREF" {
+		entry.Reference = strings.TrimSpace(match[8])
+	}
+	if entry.Reference == "" {
+		return entry, fmt.Errorf("no reference")
+	}
+
+	var supplementary []string
+	for _, line := range field.Lines[1:] {
+		if line = strings.TrimSpace(line); line != "" {
+			supplementary = append(supplementary, line)
+		}
+	}
+	entry.Description = strings.Join(supplementary, " ")
+	entry.Source = fmt.Sprintf("line %d", field.Line)
+
+	return entry, nil
+}
+
+// Parse an MT940 balance, signed by its debit/credit mark
+func parseMTBalance(value string) (float64, string, error) {
+	match := mtBalance.FindStringSubmatch(value)
+	if match == nil {
+		return 0, "", fmt.Errorf("invalid balance %q", value)
+	}
+	amount, err := strconv.ParseFloat(strings.Replace(match[4], ",", ".", 1), 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid amount %q", match[4])
+	}
+	if match[1] == "D" {
+		amount = -amount
+	}
+	return amount, match[3], nil
+}
@@ -0,0 +1,95 @@
+package ingest
+
+import "testing"
+
+func TestParseMT940(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        string
+		format      string
+		description string
+		want        []string
+		err         string
+	}{
+		{
+			name: "statement",
+			data: `{1:F01BANKDEFFXXXX0000000000}{2:O9401200240106BANKDEFFXXXX00000000002401061200N}{4:
+:20:STMT1
+:25:DE89370400440532013000
+:28C:1/1
+:60F:C240101EUR1000,00
+:61:2401050105C250,00NTRFREF1//BANK1
+:86:Invoice 42
+ paid in full
+:61:240106D75,50NCHKNONREF//B2
+:62F:C240106EUR1174,50
+-}`,
+			format:      "mt940",
+			description: "Invoice 42 paid in full",
+			want:        []string{"REF1 2024-01-05 250.00 credit", "B2 2024-01-06 -75.50 debit"},
+		},
+		{
+			name: "reversals and the turn of the year",
+			data: `:20:STMT2
+:25:12345
+:60F:C231231EUR100,00
+:61:2312310102RC40,00NTRFR1
+:61:231231RD15,00NTRFR2
+:62F:C240102EUR75,00
+-`,
+			format: "mt940",
+			want:   []string{"R1 2024-01-02 -40.00 debit", "R2 2023-12-31 15.00 credit"},
+		},
+		{
+			name: "interim report",
+			data: `:20:INT1
+:25:12345
+:34F:EURD0,
+:13D:2401051200+0100
+:61:240105C10,00NTRFR1
+-`,
+			format: "mt942",
+			want:   []string{"R1 2024-01-05 10.00 credit"},
+		},
+		{
+			name: "balances don't add up",
+			data: `:20:STMT1
+:25:12345
+:60F:C240101EUR100,00
+:61:240105C10,00NTRFR1
+:62F:C240105EUR100,00
+-`,
+			err: "don't add up",
+		},
+		{
+			name: "no reference",
+			data: `:20:STMT1
+:25:12345
+:61:240105C10,00NTRFNONREF
+-`,
+			err: "no reference",
+		},
+		{
+			name: "invalid statement line",
+			data: `:20:STMT1
+:25:12345
+:61:2401XXC10,00NTRFR1
+-`,
+			err: "invalid statement line",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			document, err := Parse("statement.sta", []byte(tc.data), Options{})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != tc.format || document.Kind != KindStatement {
+				t.Errorf("format %q, kind %q, want %q", document.Format, document.Kind, tc.format)
+			}
+			checkEntries(t, document.Entries, tc.want)
+			if tc.description != "" && document.Entries[0].Description != tc.description {
+				t.Errorf("description %q, want %q", document.Entries[0].Description, tc.description)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bank statement of an OFX or QFX download. The balances are nil when the
+// file doesn't carry them.
+type ofxStatement struct {
+	Account          string
+	Currency         string
+	Transactions     []ofxTransaction
+	LedgerBalance    *ofxBalance
+	AvailableBalance *ofxBalance
+}
+
+// <STMTTRN> record of an OFX statement. Amount is signed: deposits are
+// positive and withdrawals negative.
+type ofxTransaction struct {
+	FITID  string
+	Type   string
+	Date   time.Time
+	Amount float64
+	Name   string
+	Memo   string
+}
+
+// Balance of an OFX statement on a date
+type ofxBalance struct {
+	Amount float64
+	AsOf   time.Time
+}
+
+// OFX and QFX bank statements
+var ofxFormat = format{name: "ofx", detect: isOFX, parse: func(r io.Reader, _ Options) (Document, error) {
+	statement, err := parseOFX(r)
+	if err != nil {
+		return Document{}, err
+	}
+	return statement.document(), nil
+}}
+
+// Whether a file is an OFX statement, by its extension or, failing that, by
+// its header or the root element of version 2 files
+func isOFX(name string, head []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ofx", ".qfx":
+		return true
+	}
+	if root, _ := xmlRoot(head); root == "OFX" {
+		return true
+	}
+	head = bytes.ToUpper(head[:min(len(head), 1024)])
+	return bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(head, []byte("<OFX>"))
+}
+
+// Parse an OFX statement. Version 1 files are SGML, where elements holding a
+// value aren't closed, and version 2 files are XML; both read the same way:
+// a tag followed by text is a value, any other tag opens an aggregate.
+func parseOFX(r io.Reader) (ofxStatement, error) {
+	var statement ofxStatement
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return statement, err
+	}
+	start := bytes.Index(bytes.ToUpper(data), []byte("<OFX>"))
+	if start < 0 {
+		return statement, fmt.Errorf("no <OFX> element")
+	}
+	body := string(data[start:])
+
+	var aggregates []string
+	var transaction *ofxTransaction
+	var balance *ofxBalance
+	in := func(aggregate string) bool {
+		for _, name := range aggregates {
+			if name == aggregate {
+				return true
+			}
+		}
+		return false
+	}
+
+	for len(body) > 0 {
+		open := strings.IndexByte(body, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(body[open:], '>')
+		if end < 0 {
+			return statement, fmt.Errorf("unterminated tag")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(body[open+1 : open+end]))
+		body = body[open+end+1:]
+
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(tag, "/"); ok {
+			// Close the aggregate and any elements left open inside it
+			for i := len(aggregates) - 1; i >= 0; i-- {
+				if aggregates[i] != name {
+					continue
+				}
+				aggregates = aggregates[:i]
+				switch name {
+				case "STMTTRN":
+					if transaction != nil {
+						statement.Transactions = append(statement.Transactions, *transaction)
+						transaction = nil
+					}
+				case "LEDGERBAL":
+					statement.LedgerBalance, balance = balance, nil
+				case "AVAILBAL":
+					statement.AvailableBalance, balance = balance, nil
+				}
+				break
+			}
+			continue
+		}
+
+		next := strings.IndexByte(body, '<')
+		if next < 0 {
+			next = len(body)
+		}
+		value := strings.TrimSpace(html.UnescapeString(body[:next]))
+		if value == "" {
+			aggregates = append(aggregates, tag)
+			switch tag {
+			case "STMTTRN":
+				transaction = &ofxTransaction{}
+			case "LEDGERBAL", "AVAILBAL":
+				balance = &ofxBalance{}
+			}
+			continue
+		}
+
+		switch {
+		case transaction != nil:
+			switch tag {
+			case "FITID":
+				transaction.FITID = value
+			case "TRNTYPE":
+				transaction.Type = value
+			case "DTPOSTED":
+				transaction.Date, err = parseOFXDate(value)
+			case "TRNAMT":
+				transaction.Amount, err = parseOFXAmount(value)
+			case "NAME", "PAYEE":
+				transaction.Name = value
+			case "MEMO":
+				transaction.Memo = value
+			}
+			if err != nil {
+				return statement, fmt.Errorf("transaction %d: %s: %w", len(statement.Transactions)+1, tag, err)
+			}
+		case balance != nil:
+			switch tag {
+			case "BALAMT":
+				balance.Amount, err = parseOFXAmount(value)
+			case "DTASOF":
+				balance.AsOf, err = parseOFXDate(value)
+			}
+			if err != nil {
+				return statement, fmt.Errorf("balance: %s: %w", tag, err)
+			}
+		case tag == "ACCTID" && (in("BANKACCTFROM") || in("CCACCTFROM")):
+			statement.Account = value
+		case tag == "CURDEF":
+			statement.Currency = value
+		}
+	}
+
+	for i, transaction := range statement.Transactions {
+		if transaction.FITID == "" || transaction.Date.IsZero() {
+			return statement, fmt.Errorf("transaction %d: missing FITID or DTPOSTED", i+1)
+		}
+	}
+	return statement, nil
+}
+
+// Parse an OFX date, YYYYMMDD optionally followed by the time and zone,
+// e.g. 20240105120000.000[-5:EST]. Only the day is kept.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+// Parse an OFX amount, which some banks write with a decimal comma
+func parseOFXAmount(value string) (float64, error) {
+	if !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// Statement of the OFX file as a document, with the FITIDs as references.
+// OFX only carries the closing balance.
+func (s ofxStatement) document() Document {
+	imported := Document{Format: "ofx", Kind: KindStatement, Account: s.Account, Currency: s.Currency}
+	for i, record := range s.Transactions {
+		description := record.Name
+		if record.Memo != "" {
+			description = strings.TrimSpace(description + " " + record.Memo)
+		}
+		imported.Entries = append(imported.Entries, Entry{
+			Reference:   record.FITID,
+			Date:        record.Date,
+			Amount:      record.Amount,
+			Description: description,
+			Source:      fmt.Sprintf("STMTTRN %d", i+1),
+		})
+	}
+	if s.LedgerBalance != nil {
+		closing := s.LedgerBalance.Amount
+		imported.Closing = &closing
+	}
+	imported.sideBySign(Credit)
+	return imported
+}
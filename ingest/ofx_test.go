@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseOFX(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		data    string
+		account string
+		closing string
+		want    []string
+		err     string
+	}{
+		{
+			name: "sgml",
+			file: "stmt.qfx",
+			data: `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>USD
+<BANKACCTFROM><BANKID>1<ACCTID>12345<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20240105120000.000[-5:EST]<TRNAMT>250.00<FITID>F1<NAME>Deposit</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240106<TRNAMT>-75.5<FITID>F2<NAME>Fee<MEMO>Monthly</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>1000.00<DTASOF>20240131</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`,
+			account: "12345",
+			closing: "1000.00",
+			want:    []string{"F1 2024-01-05 250.00 credit", "F2 2024-01-06 -75.50 debit"},
+		},
+		{
+			name: "xml with decimal comma",
+			file: "export",
+			data: `<?xml version="1.0"?><?OFX OFXHEADER="200"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS><CURDEF>EUR</CURDEF>
+<CCACCTFROM><ACCTID>9876</ACCTID></CCACCTFROM>
+<BANKTRANLIST><STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240210</DTPOSTED><TRNAMT>-12,30</TRNAMT><FITID>X&amp;1</FITID></STMTTRN></BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`,
+			account: "9876",
+			want:    []string{"X&1 2024-02-10 -12.30 debit"},
+		},
+		{
+			name: "missing fitid",
+			file: "stmt.ofx",
+			data: `<OFX><STMTTRN><DTPOSTED>20240105<TRNAMT>1.00</STMTTRN></OFX>`,
+			err:  "missing FITID",
+		},
+		{
+			name: "bad amount",
+			file: "stmt.ofx",
+			data: `<OFX><STMTTRN><FITID>1<DTPOSTED>20240105<TRNAMT>abc</STMTTRN></OFX>`,
+			err:  "invalid amount",
+		},
+		{
+			name: "no ofx element",
+			file: "stmt.ofx",
+			data: `OFXHEADER:100`,
+			err:  "no <OFX> element",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			document, err := Parse(tc.file, []byte(tc.data), Options{})
+			if !checkError(t, err, tc.err) {
+				return
+			}
+			if document.Format != "ofx" || document.Kind != KindStatement || document.Account != tc.account {
+				t.Errorf("format %q, kind %q, account %q", document.Format, document.Kind, document.Account)
+			}
+			closing := ""
+			if document.Closing != nil {
+				closing = fmt.Sprintf("%.2f", *document.Closing)
+			}
+			if closing != tc.closing {
+				t.Errorf("closing balance %q, want %q", closing, tc.closing)
+			}
+			checkEntries(t, document.Entries, tc.want)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin/cleaner"
+	"github.com/xuri/excelize/v2"
+)
+
+// Magic bytes of zip archives, which OOXML workbooks are, and of the
+// compound files password protected workbooks are wrapped in
+var (
+	zipMagic = []byte("PK\x03\x04")
+	cfbMagic = []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+)
+
+// Dialect of the CSV the cleaner writes
+var cleanerDialect = Dialect{Delimiter: ",", Encoding: encodingUTF8, Decimal: "."}
+
+// ERP workbook exports, cleaned with the profile of the options. The
+// entries of the credit sheet are credits and those of the debit sheet
+// debits.
+var xlsxFormat = format{name: "xlsx", detect: isXLSX, parse: parseXLSX}
+
+// Whether an input is a workbook, by its magic bytes or its extension
+func isXLSX(name string, head []byte) bool {
+	if bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, cfbMagic) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xlsx", ".xlsm":
+		return true
+	}
+	return false
+}
+
+// Clean a workbook and read the CSV of both of its sides
+func parseXLSX(r io.Reader, options Options) (Document, error) {
+	document := Document{Format: "xlsx", Kind: KindTable}
+
+	profile := cleaner.DefaultProfile
+	if options.Profile != nil {
+		profile = *options.Profile
+	}
+	creditCSV, debitCSV, err := cleaner.CleanReader(r, profile, excelize.Options{Password: options.Password})
+	if err != nil {
+		return document, err
+	}
+
+	for _, sheet := range []struct{ side, csv string }{{Credit, creditCSV}, {Debit, debitCSV}} {
+		rows, err := parseCSV(strings.NewReader(sheet.csv), cleanerDialect)
+		if err != nil {
+			return document, err
+		}
+		for _, entry := range rows.Entries {
+			entry.Side = sheet.side
+			document.Entries = append(document.Entries, entry)
+		}
+		document.Rejected = append(document.Rejected, rows.Rejected...)
+	}
+	return document, nil
+}